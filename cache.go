@@ -0,0 +1,251 @@
+package vatel
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// CachePolicy describes caching of GET endpoint's responses.
+//
+// Successful responses get header ETag computed from the response body or
+// returned by controller implementing ETagger, and header Last-Modified if controller
+// implements LastModifier. Requests with matching If-None-Match or If-Modified-Since
+// get status 304 without body.
+type CachePolicy struct {
+	// CacheControl is the value of header Cache-Control (e.g. "private, max-age=60").
+	CacheControl string
+
+	// ServerTTL turns on server side caching of responses if positive.
+	// Cached response is returned without calling controller.
+	ServerTTL time.Duration
+
+	// Shared defines that server side cached response is shared between users.
+	// By default responses are cached per user.
+	Shared bool
+}
+
+// ETagger is the interface what wraps a single method ETag.
+//
+// If controller of endpoint having CachePolicy implements ETagger, ETag is called
+// after Handle and its result is used as entity tag instead of the hash of response body.
+type ETagger interface {
+	ETag() string
+}
+
+// LastModifier is the interface what wraps a single method LastModified.
+//
+// If controller of endpoint having CachePolicy implements LastModifier, LastModified
+// is called after Handle and its result is sent in header Last-Modified.
+type LastModifier interface {
+	LastModified() time.Time
+}
+
+// ResponseCache is the interface of server side response cache storage.
+//
+// Get returns cached response by key.
+//
+// Set stores response for ttl.
+//
+// InvalidatePrefix removes all responses having keys with the prefix.
+type ResponseCache interface {
+	Get(key string) (*StoredResponse, bool)
+	Set(key string, resp *StoredResponse, ttl time.Duration)
+	InvalidatePrefix(prefix string)
+}
+
+// SetResponseCache assigns storage of server side response cache. If cache is
+// not assigned, endpoints having CachePolicy.ServerTTL use in-memory storage.
+func (v *Vatel) SetResponseCache(rc ResponseCache) {
+	v.rc = rc
+}
+
+// InvalidateCache removes server side cached responses of all endpoints
+// with request path starting with prefix (e.g. "/api/customers").
+func (v *Vatel) InvalidateCache(prefix string) {
+	if v.rc != nil {
+		v.rc.InvalidatePrefix(prefix)
+	}
+}
+
+// MemoryResponseCache implements ResponseCache keeping responses in memory.
+type MemoryResponseCache struct {
+	mu          sync.RWMutex
+	items       map[string]*cacheItem
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+type cacheItem struct {
+	resp    *StoredResponse
+	expires time.Time
+}
+
+// memoryCacheCleanupPeriod defines how often expired responses are removed from memory.
+const memoryCacheCleanupPeriod = time.Minute
+
+// NewMemoryResponseCache returns new in-memory response cache.
+func NewMemoryResponseCache() *MemoryResponseCache {
+	return &MemoryResponseCache{items: make(map[string]*cacheItem), now: time.Now}
+}
+
+// Get implements ResponseCache.
+func (c *MemoryResponseCache) Get(key string) (*StoredResponse, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, ok := c.items[key]
+	if !ok || c.now().After(item.expires) {
+		return nil, false
+	}
+	return item.resp, true
+}
+
+// Set implements ResponseCache.
+func (c *MemoryResponseCache) Set(key string, resp *StoredResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastCleanup) > memoryCacheCleanupPeriod {
+		for k, item := range c.items {
+			if now.After(item.expires) {
+				delete(c.items, k)
+			}
+		}
+		c.lastCleanup = now
+	}
+	c.items[key] = &cacheItem{resp: resp, expires: now.Add(ttl)}
+}
+
+// InvalidatePrefix implements ResponseCache.
+func (c *MemoryResponseCache) InvalidatePrefix(prefix string) {
+	c.mu.Lock()
+	for k := range c.items {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.items, k)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// cacheKey returns key of server side cache: request path, sorted query, negotiated
+// response media type mt and user if the response is not shared.
+func (e *Endpoint) cacheKey(fctx *fasthttp.RequestCtx, tp TokenPayloader, mt string) string {
+	var args []string
+	fctx.QueryArgs().VisitAll(func(k, v []byte) {
+		args = append(args, string(k)+"="+string(v))
+	})
+	sort.Strings(args)
+
+	key := string(fctx.Path()) + "?" + strings.Join(args, "&") + " " + mt
+	if !e.Cache.Shared && tp != nil {
+		key += " " + tp.User().String() + ":" + tp.Login()
+	}
+	return key
+}
+
+// replayCachedResponse writes cached response if it exists.
+// Returns true if response is written.
+func (e *Endpoint) replayCachedResponse(fctx *fasthttp.RequestCtx, key string) bool {
+	resp, ok := e.rc.Get(key)
+	if !ok {
+		return false
+	}
+	resp.write(fctx)
+	fctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderAccept)
+	fctx.Response.Header.Set("X-Cache", "HIT")
+	e.checkNotModified(fctx, time.Time{})
+	return true
+}
+
+// applyCachePolicy sets caching headers of successful response, stores it in
+// server side cache and replaces it by 304 if client has actual version.
+func (e *Endpoint) applyCachePolicy(fctx *fasthttp.RequestCtx, h Handler, key string) {
+
+	if fctx.Response.StatusCode() != fasthttp.StatusOK {
+		return
+	}
+
+	var etag string
+	if et, ok := h.(ETagger); ok {
+		etag = quoteETag(et.ETag())
+	} else {
+		sum := sha256.Sum256(fctx.Response.Body())
+		etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	}
+	fctx.Response.Header.Set(fasthttp.HeaderETag, etag)
+
+	var lm time.Time
+	if lmr, ok := h.(LastModifier); ok {
+		if lm = lmr.LastModified(); !lm.IsZero() {
+			fctx.Response.Header.Set(fasthttp.HeaderLastModified, string(fasthttp.AppendHTTPDate(nil, lm)))
+		}
+	}
+
+	if e.Cache.CacheControl != "" {
+		fctx.Response.Header.Set(fasthttp.HeaderCacheControl, e.Cache.CacheControl)
+	}
+
+	// response body depends on the media type negotiated by header Accept.
+	fctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderAccept)
+
+	if key != "" {
+		e.rc.Set(key, captureResponse(fctx), e.Cache.ServerTTL)
+	}
+
+	e.checkNotModified(fctx, lm)
+}
+
+// checkNotModified replaces response by 304 if request's If-None-Match matches
+// response's ETag or, if there is no If-None-Match, If-Modified-Since is not before
+// the time of the last modification lm.
+func (e *Endpoint) checkNotModified(fctx *fasthttp.RequestCtx, lm time.Time) {
+
+	notModified := false
+	if inm := fctx.Request.Header.Peek(fasthttp.HeaderIfNoneMatch); len(inm) > 0 {
+		notModified = etagMatch(inm, fctx.Response.Header.Peek(fasthttp.HeaderETag))
+	} else if ims := fctx.Request.Header.Peek(fasthttp.HeaderIfModifiedSince); len(ims) > 0 {
+		if lm.IsZero() {
+			lm, _ = fasthttp.ParseHTTPDate(fctx.Response.Header.Peek(fasthttp.HeaderLastModified))
+		}
+		if t, err := fasthttp.ParseHTTPDate(ims); err == nil && !lm.IsZero() {
+			notModified = !lm.Truncate(time.Second).After(t)
+		}
+	}
+
+	if notModified {
+		fctx.SetStatusCode(fasthttp.StatusNotModified)
+		fctx.Response.ResetBody()
+	}
+}
+
+// quoteETag returns entity tag in double quotes.
+func quoteETag(s string) string {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, `W/"`) {
+		return s
+	}
+	return `"` + s + `"`
+}
+
+// etagMatch returns true if header If-None-Match value inm matches etag using weak comparison.
+func etagMatch(inm, etag []byte) bool {
+	if len(etag) == 0 {
+		return false
+	}
+	etag = bytes.TrimPrefix(etag, []byte("W/"))
+
+	for _, t := range bytes.Split(inm, []byte(",")) {
+		t = bytes.TrimSpace(t)
+		if string(t) == "*" || bytes.Equal(bytes.TrimPrefix(t, []byte("W/")), etag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package vatel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+type testCachedController struct {
+	calls *int
+	res   struct {
+		Name string `json:"name"`
+	}
+}
+
+func (c *testCachedController) Result() interface{} { return &c.res }
+func (c *testCachedController) Handle(Context) error {
+	*c.calls++
+	c.res.Name = "John"
+	return nil
+}
+
+type testETagController struct{ testCachedController }
+
+func (c *testETagController) ETag() string { return "v1" }
+func (c *testETagController) LastModified() time.Time {
+	return time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+}
+
+func TestEndpoint_Cache(t *testing.T) {
+
+	calls := 0
+	v := newTestVatel()
+	e := Endpoint{Method: "GET", Path: "/customers", Cache: &CachePolicy{CacheControl: "private, max-age=60", ServerTTL: time.Minute},
+		Controller: func() Handler { return &testCachedController{calls: &calls} }}
+	if err := e.compile(v); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	h := e.handler(&l)
+
+	request := func(uri, inm string) *fasthttp.RequestCtx {
+		var fctx fasthttp.RequestCtx
+		fctx.Request.SetRequestURI(uri)
+		if inm != "" {
+			fctx.Request.Header.Set(fasthttp.HeaderIfNoneMatch, inm)
+		}
+		h(&fctx)
+		return &fctx
+	}
+
+	fctx := request("/customers?b=2&a=1", "")
+	etag := string(fctx.Response.Header.Peek(fasthttp.HeaderETag))
+	if fctx.Response.StatusCode() != 200 || len(etag) != 34 || string(fctx.Response.Header.Peek(fasthttp.HeaderCacheControl)) != "private, max-age=60" {
+		t.Fatalf("unexpected response: %d %s", fctx.Response.StatusCode(), fctx.Response.Header.String())
+	}
+
+	fctx = request("/customers?a=1&b=2", "")
+	if calls != 1 || string(fctx.Response.Header.Peek("X-Cache")) != "HIT" || string(fctx.Response.Body()) != `{"name":"John"}` {
+		t.Fatalf("cached response expected, calls %d: %s", calls, fctx.Response.Header.String())
+	}
+
+	if string(fctx.Response.Header.Peek(fasthttp.HeaderVary)) != "Accept" {
+		t.Errorf("Vary: Accept expected, got %s", fctx.Response.Header.String())
+	}
+
+	// response of another media type is cached separately.
+	var mctx fasthttp.RequestCtx
+	mctx.Request.SetRequestURI("/customers?a=1&b=2")
+	mctx.Request.Header.Set(fasthttp.HeaderAccept, "application/msgpack")
+	h(&mctx)
+	if calls != 2 || len(mctx.Response.Header.Peek("X-Cache")) != 0 || string(mctx.Response.Header.ContentType()) != "application/msgpack" {
+		t.Fatalf("not cached msgpack response expected, calls %d: %s", calls, mctx.Response.Header.String())
+	}
+	if fctx = request("/customers?a=1&b=2", ""); calls != 2 || string(fctx.Response.Body()) != `{"name":"John"}` {
+		t.Fatalf("cached JSON response expected, calls %d: %s", calls, fctx.Response.Body())
+	}
+
+	fctx = request("/customers?a=1&b=2", `"other", W/`+etag)
+	if fctx.Response.StatusCode() != 304 || len(fctx.Response.Body()) != 0 {
+		t.Errorf("expected 304, got %d", fctx.Response.StatusCode())
+	}
+
+	v.InvalidateCache("/customers")
+	if fctx = request("/customers?a=1&b=2", etag); calls != 3 || fctx.Response.StatusCode() != 304 {
+		t.Errorf("expected 304 after invalidation, got %d, calls %d", fctx.Response.StatusCode(), calls)
+	}
+
+	e = Endpoint{Method: "GET", Path: "/tagged", Cache: &CachePolicy{}, Controller: func() Handler { return &testETagController{testCachedController{calls: &calls}} }}
+	if err := e.compile(v); err != nil {
+		t.Fatal(err)
+	}
+	h = e.handler(&l)
+
+	if fctx = request("/tagged", ""); string(fctx.Response.Header.Peek(fasthttp.HeaderETag)) != `"v1"` ||
+		string(fctx.Response.Header.Peek(fasthttp.HeaderLastModified)) != "Wed, 01 Sep 2021 10:00:00 GMT" {
+		t.Errorf("unexpected headers: %s", fctx.Response.Header.String())
+	}
+
+	var ims fasthttp.RequestCtx
+	ims.Request.Header.Set(fasthttp.HeaderIfModifiedSince, "Wed, 01 Sep 2021 10:00:00 GMT")
+	h(&ims)
+	if ims.Response.StatusCode() != 304 {
+		t.Errorf("expected 304 by If-Modified-Since, got %d", ims.Response.StatusCode())
+	}
+
+	e = Endpoint{Method: "POST", Path: "/customers", Cache: &CachePolicy{}, Controller: func() Handler { return &testNopController{} }}
+	if err := e.compile(v); err == nil {
+		t.Error("error expected for POST")
+	}
+}
@@ -0,0 +1,151 @@
+package vatel
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/axkit/errors"
+	"github.com/golangkit/vatel/codec"
+	"github.com/valyala/fasthttp"
+)
+
+// Codec is the interface what wraps methods Marshal and Unmarshal.
+//
+// Codec converts request and response bodies of the specific media type.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		"application/json":        codec.JSON{},
+		"application/msgpack":     codec.MsgPack{},
+		"application/x-msgpack":   codec.MsgPack{},
+		"application/vnd.msgpack": codec.MsgPack{},
+		"application/cbor":        codec.CBOR{},
+	}
+)
+
+// RegisterCodec registers codec of request and response bodies having media type
+// mediaType (e.g. "application/msgpack"). Registered codec replaces the previous one.
+//
+// Codec of request body is selected by header Content-Type, codec of response body
+// by header Accept. JSON, MessagePack and CBOR codecs are registered by default.
+// XML codec is opt-in because browsers accept application/xml, and encoding/xml
+// does not support maps:
+//
+//	vatel.RegisterCodec("application/xml", codec.XML{})
+func RegisterCodec(mediaType string, c Codec) {
+	codecsMu.Lock()
+	codecs[strings.ToLower(mediaType)] = c
+	codecsMu.Unlock()
+}
+
+func lookupCodec(mediaType string) (Codec, bool) {
+	codecsMu.RLock()
+	c, ok := codecs[mediaType]
+	codecsMu.RUnlock()
+	return c, ok
+}
+
+var (
+	ErrUnsupportedMediaType = errors.New("unsupported media type").Code("VTL-0004").StatusCode(415)
+	ErrNotAcceptable        = errors.New("not acceptable").Code("VTL-0005").StatusCode(406)
+)
+
+// mediaType returns lowercased media type of the header Content-Type value without parameters.
+func mediaType(ct []byte) string {
+	if idx := bytes.IndexByte(ct, ';'); idx >= 0 {
+		ct = ct[:idx]
+	}
+	return strings.ToLower(string(bytes.TrimSpace(ct)))
+}
+
+// isJSONMediaType returns true if the body of media type mt can be written to the log as is.
+func isJSONMediaType(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// requestCodec returns codec of the request body selected by header Content-Type.
+// JSON is assumed if header is missed.
+func requestCodec(ctx *fasthttp.RequestCtx) (Codec, string, error) {
+	mt := mediaType(ctx.Request.Header.ContentType())
+	if mt == "" {
+		mt = "application/json"
+	}
+
+	c, ok := lookupCodec(mt)
+	if !ok {
+		return nil, mt, ErrUnsupportedMediaType.Capture()
+	}
+	return c, mt, nil
+}
+
+// responseCodec returns codec and content type of the response body selected by
+// header Accept. Endpoint's ResponseContentType is used if header is missed or
+// accepts any media type.
+func (e *Endpoint) responseCodec(ctx *fasthttp.RequestCtx) (Codec, []byte, string, error) {
+
+	accept := ctx.Request.Header.Peek("Accept")
+	if len(bytes.TrimSpace(accept)) == 0 {
+		return e.respCodec, e.responseContentType, e.respMediaType, nil
+	}
+
+	for _, mr := range parseAccept(string(accept)) {
+		if mr == "*/*" || mr == e.respMediaType || mr == e.respMediaType[:strings.IndexByte(e.respMediaType, '/')+1]+"*" {
+			return e.respCodec, e.responseContentType, e.respMediaType, nil
+		}
+		if c, ok := lookupCodec(mr); ok {
+			ct := mr
+			if isJSONMediaType(mr) {
+				ct += "; charset=utf-8"
+			}
+			return c, []byte(ct), mr, nil
+		}
+	}
+
+	return nil, nil, "", ErrNotAcceptable.Capture()
+}
+
+// parseAccept returns media ranges of the header Accept value ordered by quality.
+// Media ranges with zero quality are skipped.
+func parseAccept(accept string) []string {
+
+	type mediaRange struct {
+		name string
+		q    float64
+	}
+
+	var mrs []mediaRange
+	for _, item := range strings.Split(accept, ",") {
+		params := strings.Split(item, ";")
+		mr := mediaRange{name: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		if mr.name == "" {
+			continue
+		}
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if q, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+		if mr.q > 0 {
+			mrs = append(mrs, mr)
+		}
+	}
+
+	sort.SliceStable(mrs, func(i, j int) bool { return mrs[i].q > mrs[j].q })
+
+	res := make([]string, len(mrs))
+	for i := range mrs {
+		res[i] = mrs[i].name
+	}
+	return res
+}
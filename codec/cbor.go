@@ -0,0 +1,336 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// CBOR implements codec of Concise Binary Object Representation (RFC 8949).
+type CBOR struct{}
+
+// Major types of CBOR data items.
+const (
+	cborUint   byte = 0 << 5
+	cborNegInt byte = 1 << 5
+	cborBytes  byte = 2 << 5
+	cborText   byte = 3 << 5
+	cborArray  byte = 4 << 5
+	cborMap    byte = 5 << 5
+	cborTag    byte = 6 << 5
+	cborSimple byte = 7 << 5
+)
+
+// cborIndefinite is additional information of the items with indefinite length.
+const cborIndefinite = 31
+
+// cborBreak terminates items with indefinite length.
+const cborBreak = 0xff
+
+// Marshal returns CBOR encoding of v.
+func (CBOR) Marshal(v interface{}) ([]byte, error) {
+	g, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendCBOR(nil, g)
+}
+
+// Unmarshal parses CBOR encoded data and stores the result in the value pointed to by v.
+func (CBOR) Unmarshal(data []byte, v interface{}) error {
+	d := cborDecoder{msgpackDecoder{buf: data}}
+	g, err := d.decode(0)
+	if err != nil {
+		return err
+	}
+	if d.pos != len(d.buf) {
+		return errors.New("cbor: unexpected data after top-level value")
+	}
+	return fromGeneric(g, v)
+}
+
+func appendCBOR(b []byte, g interface{}) ([]byte, error) {
+	var err error
+
+	switch x := g.(type) {
+	case nil:
+		b = append(b, cborSimple|22)
+	case bool:
+		if x {
+			b = append(b, cborSimple|21)
+		} else {
+			b = append(b, cborSimple|20)
+		}
+	case json.Number:
+		if i, err := strconv.ParseInt(string(x), 10, 64); err == nil {
+			if i < 0 {
+				return appendCBORHead(b, cborNegInt, uint64(-1-i)), nil
+			}
+			return appendCBORHead(b, cborUint, uint64(i)), nil
+		}
+		if u, err := strconv.ParseUint(string(x), 10, 64); err == nil {
+			return appendCBORHead(b, cborUint, u), nil
+		}
+		f, err := x.Float64()
+		if err != nil {
+			return nil, err
+		}
+		b = append(append(b, cborSimple|27), uint64be(math.Float64bits(f))...)
+	case string:
+		b = appendCBORHead(b, cborText, uint64(len(x)))
+		b = append(b, x...)
+	case []interface{}:
+		b = appendCBORHead(b, cborArray, uint64(len(x)))
+		for i := range x {
+			if b, err = appendCBOR(b, x[i]); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		b = appendCBORHead(b, cborMap, uint64(len(x)))
+		for k, v := range x {
+			b = appendCBORHead(b, cborText, uint64(len(k)))
+			b = append(b, k...)
+			if b, err = appendCBOR(b, v); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("cbor: unsupported type %T", g)
+	}
+	return b, nil
+}
+
+// appendCBORHead appends the initial byte of the data item and its argument n
+// using the shortest form.
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return append(b, major|25, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		return append(append(b, major|26), uint32be(uint32(n))...)
+	}
+	return append(append(b, major|27), uint64be(n)...)
+}
+
+type cborDecoder struct {
+	msgpackDecoder
+}
+
+// head reads the initial byte and the argument of the data item.
+func (d *cborDecoder) head() (major, info byte, arg uint64, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]&0xe0, b[0]&0x1f
+
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		arg, err = d.uint(1 << (info - 24))
+	case info == cborIndefinite:
+	default:
+		err = fmt.Errorf("cbor: invalid additional information %d", info)
+	}
+	return major, info, arg, err
+}
+
+// isBreak returns true and skips the break code if it's the next byte.
+func (d *cborDecoder) isBreak() (bool, error) {
+	if d.pos >= len(d.buf) {
+		return false, errUnexpectedEnd
+	}
+	if d.buf[d.pos] == cborBreak {
+		d.pos++
+		return true, nil
+	}
+	return false, nil
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+
+	if depth > maxNestingDepth {
+		return nil, errors.New("cbor: max nesting depth exceeded")
+	}
+
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	if info == cborIndefinite {
+		return d.decodeIndefinite(major, depth)
+	}
+
+	switch major {
+	case cborUint:
+		return arg, nil
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return -1 - float64(arg), nil
+		}
+		return -1 - int64(arg), nil
+	case cborBytes:
+		b, err := d.next(int(arg))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case cborText:
+		return d.decodeString(int(arg))
+	case cborArray:
+		if arg > uint64(len(d.buf)-d.pos) {
+			return nil, errUnexpectedEnd
+		}
+		res := make([]interface{}, arg)
+		for i := range res {
+			if res[i], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case cborMap:
+		if arg > uint64(len(d.buf)-d.pos) {
+			return nil, errUnexpectedEnd
+		}
+		res := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			if err := d.decodeMapItem(res, depth); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case cborTag:
+		// Tags (dates, bignums, etc.) are ignored, tagged item is decoded as is.
+		return d.decode(depth + 1)
+	}
+
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfToFloat64(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", arg)
+}
+
+func (d *cborDecoder) decodeMapItem(m map[string]interface{}, depth int) error {
+	k, err := d.decode(depth + 1)
+	if err != nil {
+		return err
+	}
+	v, err := d.decode(depth + 1)
+	if err != nil {
+		return err
+	}
+	if b, ok := k.([]byte); ok {
+		k = string(b)
+	}
+	m[fmt.Sprint(k)] = v
+	return nil
+}
+
+func (d *cborDecoder) decodeIndefinite(major byte, depth int) (interface{}, error) {
+
+	switch major {
+	case cborBytes, cborText:
+		var res []byte
+		for {
+			brk, err := d.isBreak()
+			if err != nil {
+				return nil, err
+			}
+			if brk {
+				break
+			}
+			m, info, arg, err := d.head()
+			if err != nil {
+				return nil, err
+			}
+			if m != major || info == cborIndefinite {
+				return nil, errors.New("cbor: invalid chunk of indefinite length string")
+			}
+			b, err := d.next(int(arg))
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, b...)
+		}
+		if major == cborText {
+			return string(res), nil
+		}
+		return res, nil
+	case cborArray:
+		res := []interface{}{}
+		for {
+			brk, err := d.isBreak()
+			if err != nil {
+				return nil, err
+			}
+			if brk {
+				return res, nil
+			}
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		}
+	case cborMap:
+		res := map[string]interface{}{}
+		for {
+			brk, err := d.isBreak()
+			if err != nil {
+				return nil, err
+			}
+			if brk {
+				return res, nil
+			}
+			if err := d.decodeMapItem(res, depth); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, errors.New("cbor: unexpected indefinite length item")
+}
+
+// halfToFloat64 converts IEEE 754 half precision number to float64.
+func halfToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var res float64
+	switch exp {
+	case 0:
+		res = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			res = math.Inf(1)
+		} else {
+			res = math.NaN()
+		}
+	default:
+		res = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -res
+	}
+	return res
+}
@@ -0,0 +1,64 @@
+// Package codec provides encoders of request and response bodies
+// in formats JSON, XML, MessagePack and CBOR.
+//
+// MessagePack and CBOR codecs convert values through their JSON representation,
+// so struct tags "json" and types implementing json.Marshaler/json.Unmarshaler
+// are respected by all codecs except XML.
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+)
+
+// JSON implements codec based on encoding/json.
+type JSON struct{}
+
+// Marshal returns JSON encoding of v.
+func (JSON) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal parses JSON encoded data and stores the result in the value pointed to by v.
+func (JSON) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// XML implements codec based on encoding/xml.
+type XML struct{}
+
+// Marshal returns XML encoding of v.
+func (XML) Marshal(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+// Unmarshal parses XML encoded data and stores the result in the value pointed to by v.
+func (XML) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+// toGeneric converts v to the tree of nil, bool, json.Number, string,
+// []interface{} and map[string]interface{} using JSON representation of v.
+func toGeneric(v interface{}) (interface{}, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var res interface{}
+	err = dec.Decode(&res)
+	return res, err
+}
+
+// fromGeneric stores the tree g in the value pointed to by v.
+func fromGeneric(g interface{}, v interface{}) error {
+	buf, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
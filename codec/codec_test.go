@@ -0,0 +1,97 @@
+package codec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type testItem struct {
+	ID     int64             `json:"id"`
+	Name   string            `json:"name"`
+	Price  float64           `json:"price"`
+	Active bool              `json:"active"`
+	Tags   []string          `json:"tags"`
+	Attrs  map[string]string `json:"attrs"`
+	Next   *testItem         `json:"next"`
+	Data   []byte            `json:"data"`
+}
+
+func TestRoundTrip(t *testing.T) {
+
+	src := testItem{
+		ID:     -100000,
+		Name:   "long name exceeding thirty two characters",
+		Price:  10.25,
+		Active: true,
+		Tags:   []string{"a", "b"},
+		Attrs:  map[string]string{"k": "v"},
+		Next:   &testItem{ID: 18446744, Name: "x"},
+		Data:   []byte{0, 1, 2},
+	}
+
+	for name, c := range map[string]interface {
+		Marshal(v interface{}) ([]byte, error)
+		Unmarshal(data []byte, v interface{}) error
+	}{"msgpack": MsgPack{}, "cbor": CBOR{}, "json": JSON{}} {
+		buf, err := c.Marshal(&src)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		var dst testItem
+		if err := c.Unmarshal(buf, &dst); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if !reflect.DeepEqual(src, dst) {
+			t.Errorf("%s: expected %+v, got %+v", name, src, dst)
+		}
+	}
+}
+
+func TestMsgPack_Marshal(t *testing.T) {
+	buf, err := MsgPack{}.Marshal(map[string]interface{}{"a": []interface{}{1, -1, 200, nil, true, "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{0x81, 0xa1, 'a', 0x96, 0x01, 0xff, 0xd1, 0x00, 0xc8, 0xc0, 0xc3, 0xa1, 'x'}
+	if !bytes.Equal(buf, expected) {
+		t.Errorf("expected %x, got %x", expected, buf)
+	}
+}
+
+func TestCBOR_Marshal(t *testing.T) {
+	buf, err := CBOR{}.Marshal(map[string]interface{}{"a": []interface{}{1, -1, 500, nil, true, "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{0xa1, 0x61, 'a', 0x86, 0x01, 0x20, 0x19, 0x01, 0xf4, 0xf6, 0xf5, 0x61, 'x'}
+	if !bytes.Equal(buf, expected) {
+		t.Errorf("expected %x, got %x", expected, buf)
+	}
+}
+
+func TestCBOR_Unmarshal(t *testing.T) {
+
+	// {_ "a": [_ 1.5 (half), "b" (indefinite text)], "c": tag 1(0)}
+	src := []byte{0xbf, 0x61, 'a', 0x9f, 0xf9, 0x3e, 0x00, 0x7f, 0x61, 'b', 0xff, 0xff, 0x61, 'c', 0xc1, 0x00, 0xff}
+
+	var dst struct {
+		A []interface{} `json:"a"`
+		C int           `json:"c"`
+	}
+	if err := (CBOR{}).Unmarshal(src, &dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dst.A) != 2 || dst.A[0] != 1.5 || dst.A[1] != "b" || dst.C != 0 {
+		t.Errorf("unexpected result: %+v", dst)
+	}
+
+	if err := (CBOR{}).Unmarshal(src[:5], &dst); err == nil {
+		t.Error("error expected for truncated data")
+	}
+}
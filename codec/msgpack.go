@@ -0,0 +1,285 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// MsgPack implements MessagePack codec.
+type MsgPack struct{}
+
+// Marshal returns MessagePack encoding of v.
+func (MsgPack) Marshal(v interface{}) ([]byte, error) {
+	g, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendMsgPack(nil, g)
+}
+
+// Unmarshal parses MessagePack encoded data and stores the result in the value pointed to by v.
+func (MsgPack) Unmarshal(data []byte, v interface{}) error {
+	d := msgpackDecoder{buf: data}
+	g, err := d.decode(0)
+	if err != nil {
+		return err
+	}
+	if d.pos != len(d.buf) {
+		return errors.New("msgpack: unexpected data after top-level value")
+	}
+	return fromGeneric(g, v)
+}
+
+func appendMsgPack(b []byte, g interface{}) ([]byte, error) {
+	var err error
+
+	switch x := g.(type) {
+	case nil:
+		b = append(b, 0xc0)
+	case bool:
+		if x {
+			b = append(b, 0xc3)
+		} else {
+			b = append(b, 0xc2)
+		}
+	case json.Number:
+		if i, err := strconv.ParseInt(string(x), 10, 64); err == nil {
+			return appendMsgPackInt(b, i), nil
+		}
+		if u, err := strconv.ParseUint(string(x), 10, 64); err == nil {
+			return append(append(b, 0xcf), uint64be(u)...), nil
+		}
+		f, err := x.Float64()
+		if err != nil {
+			return nil, err
+		}
+		b = append(append(b, 0xcb), uint64be(math.Float64bits(f))...)
+	case string:
+		b = appendMsgPackHead(b, 0xa0, 0xd9, 0xda, 0xdb, 32, len(x))
+		b = append(b, x...)
+	case []interface{}:
+		b = appendMsgPackHead(b, 0x90, 0, 0xdc, 0xdd, 16, len(x))
+		for i := range x {
+			if b, err = appendMsgPack(b, x[i]); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		b = appendMsgPackHead(b, 0x80, 0, 0xde, 0xdf, 16, len(x))
+		for k, v := range x {
+			b = appendMsgPackHead(b, 0xa0, 0xd9, 0xda, 0xdb, 32, len(k))
+			b = append(b, k...)
+			if b, err = appendMsgPack(b, v); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type %T", g)
+	}
+	return b, nil
+}
+
+// appendMsgPackHead appends type and length of string, array or map. Fix type is
+// used if n < fixLimit, c8 is skipped if it's zero.
+func appendMsgPackHead(b []byte, fix, c8, c16, c32 byte, fixLimit, n int) []byte {
+	switch {
+	case n < fixLimit:
+		return append(b, fix|byte(n))
+	case c8 != 0 && n <= math.MaxUint8:
+		return append(b, c8, byte(n))
+	case n <= math.MaxUint16:
+		return append(b, c16, byte(n>>8), byte(n))
+	}
+	return append(append(b, c32), uint32be(uint32(n))...)
+}
+
+func appendMsgPackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 127:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return append(b, 0xd1, byte(i>>8), byte(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return append(append(b, 0xd2), uint32be(uint32(i))...)
+	}
+	return append(append(b, 0xd3), uint64be(uint64(i))...)
+}
+
+func uint32be(u uint32) []byte {
+	var res [4]byte
+	binary.BigEndian.PutUint32(res[:], u)
+	return res[:]
+}
+
+func uint64be(u uint64) []byte {
+	var res [8]byte
+	binary.BigEndian.PutUint64(res[:], u)
+	return res[:]
+}
+
+// maxNestingDepth limits nesting of arrays and maps in decoded documents.
+const maxNestingDepth = 1000
+
+var errUnexpectedEnd = errors.New("unexpected end of data")
+
+type msgpackDecoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.buf)-d.pos < n {
+		return nil, errUnexpectedEnd
+	}
+	res := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return res, nil
+}
+
+// uint reads big endian unsigned integer of n bytes.
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var res uint64
+	for i := range b {
+		res = res<<8 | uint64(b[i])
+	}
+	return res, nil
+}
+
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+
+	if depth > maxNestingDepth {
+		return nil, errors.New("msgpack: max nesting depth exceeded")
+	}
+
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.decodeString(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6: // bin 8, 16, 32
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		bin, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, bin...), nil
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (c - 0xcc))
+	case 0xd0:
+		u, err := d.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := d.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := d.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := d.uint(8)
+		return int64(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(n), depth)
+	}
+
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%x", c)
+}
+
+func (d *msgpackDecoder) decodeString(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) decodeArray(n int, depth int) (interface{}, error) {
+	if n > len(d.buf)-d.pos {
+		return nil, errUnexpectedEnd
+	}
+	res := make([]interface{}, n)
+	for i := range res {
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int, depth int) (interface{}, error) {
+	if n > len(d.buf)-d.pos {
+		return nil, errUnexpectedEnd
+	}
+	res := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		res[fmt.Sprint(k)] = v
+	}
+	return res, nil
+}
@@ -0,0 +1,96 @@
+package vatel
+
+import (
+	"testing"
+
+	"github.com/golangkit/vatel/codec"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+type testEchoController struct {
+	in testCustomer
+}
+
+func (c *testEchoController) Input() interface{}   { return &c.in }
+func (c *testEchoController) Result() interface{}  { return &c.in }
+func (c *testEchoController) Handle(Context) error { return nil }
+
+func TestEndpoint_codecs(t *testing.T) {
+
+	e := Endpoint{Method: "POST", Path: "/echo", Controller: func() Handler { return &testEchoController{} }}
+	if err := e.compile(NewVatel()); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	h := e.handler(&l)
+
+	src := testCustomer{ID: 1, Name: "John", Tags: []string{"a"}}
+	body, err := codec.MsgPack{}.Marshal(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		contentType, accept string
+		body                []byte
+		status              int
+		respContentType     string
+	}{
+		{"application/msgpack", "application/cbor", body, 201, "application/cbor"},
+		{"application/msgpack", "", body, 201, "application/json; charset=utf-8"},
+		{"application/x-msgpack", "text/html;q=0.9, */*;q=0.8", body, 201, "application/json; charset=utf-8"},
+		// browser's default header.
+		{"application/msgpack", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", body, 201, "application/json; charset=utf-8"},
+		{"", "application/json", []byte(`{"id":1,"name":"John","Tags":["a"]}`), 201, "application/json; charset=utf-8"},
+		{"application/yaml", "", body, 415, ""},
+		{"application/msgpack", "text/html, application/cbor;q=0", body, 406, ""},
+	}
+
+	for i, c := range cases {
+		var fctx fasthttp.RequestCtx
+		fctx.Request.Header.SetMethod("POST")
+		fctx.Request.Header.SetContentType(c.contentType)
+		fctx.Request.Header.Set("Accept", c.accept)
+		fctx.Request.SetBody(c.body)
+
+		h(&fctx)
+
+		if sc := fctx.Response.StatusCode(); sc != c.status {
+			t.Errorf("case %d: expected status %d, got %d: %s", i, c.status, sc, fctx.Response.Body())
+			continue
+		}
+		if c.status != 201 {
+			continue
+		}
+
+		if ct := string(fctx.Response.Header.ContentType()); ct != c.respContentType {
+			t.Errorf("case %d: expected content type %s, got %s", i, c.respContentType, ct)
+		}
+
+		rc, _ := lookupCodec(mediaType([]byte(c.respContentType)))
+		var dst testCustomer
+		if err := rc.Unmarshal(fctx.Response.Body(), &dst); err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+		if dst.Name != "John" || dst.ID != 1 || len(dst.Tags) != 1 {
+			t.Errorf("case %d: unexpected result: %+v", i, dst)
+		}
+	}
+}
+
+func TestParseAccept(t *testing.T) {
+	res := parseAccept("text/html;q=0.5, application/cbor, */*;q=0.1, application/xml;q=0")
+	if len(res) != 3 || res[0] != "application/cbor" || res[1] != "text/html" || res[2] != "*/*" {
+		t.Errorf("unexpected result: %v", res)
+	}
+
+	if mt := mediaType([]byte(" Application/JSON; charset=utf-8")); mt != "application/json" {
+		t.Errorf("unexpected media type: %s", mt)
+	}
+
+	if mediaType(nil) != "" {
+		t.Error("empty media type expected")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"mime/multipart"
+	"time"
 
 	"github.com/valyala/fasthttp"
 )
@@ -23,6 +24,9 @@ type Context interface {
 	Set(key string, val interface{}) *VatelContext
 	Get(key string) interface{}
 	VisitUserValues(func(key []byte, val interface{}))
+	SetBody(body []byte) *VatelContext
+	ResponseError() error
+	Context() context.Context
 }
 
 type VatelContext struct {
@@ -30,6 +34,8 @@ type VatelContext struct {
 	fh     *fasthttp.RequestCtx
 	kv     map[string]interface{}
 	tp     TokenPayloader
+	err    error
+	std    context.Context
 }
 
 func NewContext(ctx *fasthttp.RequestCtx) Context {
@@ -39,6 +45,45 @@ func NewContext(ctx *fasthttp.RequestCtx) Context {
 	return &c
 }
 
+// requestContext is the parent of request's context.Context. Values
+// are looked up in user values of fasthttp.RequestCtx as well.
+type requestContext struct {
+	context.Context
+	fh *fasthttp.RequestCtx
+}
+
+func (rc requestContext) Value(key interface{}) interface{} {
+	if s, ok := key.(string); ok {
+		if v := rc.fh.UserValue(s); v != nil {
+			return v
+		}
+	}
+	return rc.Context.Value(key)
+}
+
+// initContext derives request's context.Context from base with timeout d if d
+// is positive. Returned function cancels the context.
+func (ctx *VatelContext) initContext(base context.Context, d time.Duration) context.CancelFunc {
+	parent := requestContext{Context: base, fh: ctx.fh}
+	if d > 0 {
+		ctx.std, ctx.cancel = context.WithTimeout(parent, d)
+	} else {
+		ctx.std, ctx.cancel = context.WithCancel(parent)
+	}
+	return ctx.cancel
+}
+
+// Context returns request's context.Context. The context is cancelled when
+// the request handler returns, endpoint's Timeout is exceeded or the context
+// set by WithBaseContext is cancelled. Disconnect of the client is not detected
+// until the response is written.
+func (ctx *VatelContext) Context() context.Context {
+	if ctx.std == nil {
+		return requestContext{Context: context.Background(), fh: ctx.fh}
+	}
+	return ctx.std
+}
+
 func (ctx *VatelContext) SetTokenPayload(tp TokenPayloader) {
 	ctx.tp = tp
 }
@@ -89,6 +134,18 @@ func (ctx *VatelContext) BodyWriter() io.Writer {
 	return ctx.fh.Response.BodyWriter()
 }
 
+// SetBody replaces response body.
+func (ctx *VatelContext) SetBody(body []byte) *VatelContext {
+	ctx.fh.Response.SetBody(body)
+	return ctx
+}
+
+// ResponseError returns the error what failed the request. It's available
+// for middlewares added at position OnErrorResponse, nil otherwise.
+func (ctx *VatelContext) ResponseError() error {
+	return ctx.err
+}
+
 // SetStatusCode sets HTTP status code.
 func (ctx *VatelContext) SetStatusCode(code int) *VatelContext {
 	ctx.fh.SetStatusCode(code)
@@ -0,0 +1,216 @@
+package vatel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+// CORSPolicy describes Cross-Origin Resource Sharing rules.
+type CORSPolicy struct {
+	// AllowedOrigins holds allowed origins. Value "*" allows any origin,
+	// "https://*.example.com" allows any subdomain of example.com.
+	AllowedOrigins []string
+
+	// AllowedMethods holds methods allowed in preflight requests.
+	// If empty, methods of endpoints registered at the path are allowed.
+	AllowedMethods []string
+
+	// AllowedHeaders holds request headers allowed in preflight requests.
+	// Value "*" allows any header. If empty, Content-Type and Authorization are allowed.
+	AllowedHeaders []string
+
+	// ExposedHeaders holds response headers accessible by browser scripts.
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests with cookies and Authorization header.
+	// It cannot be combined with AllowedOrigins "*".
+	AllowCredentials bool
+
+	// MaxAge defines how long results of preflight request can be cached.
+	MaxAge time.Duration
+}
+
+// WithCORS sets CORS policy of all endpoints. Handlers of preflight requests
+// (method OPTIONS) are registered for every path. Endpoint's policy can be
+// overridden by Endpoint.CORS.
+func WithCORS(p *CORSPolicy) func(*Option) {
+	return func(o *Option) {
+		o.cors = p
+	}
+}
+
+// defaultCORSHeaders are allowed if AllowedHeaders is empty.
+var defaultCORSHeaders = []string{"Content-Type", "Authorization"}
+
+// isOriginAllowed returns true if origin matches one of AllowedOrigins.
+func (p *CORSPolicy) isOriginAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, ao := range p.AllowedOrigins {
+		ao = strings.ToLower(ao)
+		if ao == "*" || ao == origin {
+			return true
+		}
+
+		// https://*.example.com
+		idx := strings.Index(ao, "://*.")
+		if idx < 0 {
+			continue
+		}
+		scheme, suffix := ao[:idx+3], ao[idx+4:]
+		if strings.HasPrefix(origin, scheme) && strings.HasSuffix(origin, suffix) && len(origin) > len(scheme)+len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CORSPolicy) isWildcardOrigin() bool {
+	for i := range p.AllowedOrigins {
+		if p.AllowedOrigins[i] == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns error if the policy allows credentialed requests from any
+// origin. Any site could read responses of authenticated requests otherwise.
+func (p *CORSPolicy) validate() error {
+	if p.AllowCredentials && p.isWildcardOrigin() {
+		return fmt.Errorf("CORS policy cannot allow credentials for any origin \"*\"")
+	}
+	return nil
+}
+
+// isHeaderAllowed returns true if request header h is allowed.
+func (p *CORSPolicy) isHeaderAllowed(h string) bool {
+	allowed := p.AllowedHeaders
+	if len(allowed) == 0 {
+		allowed = defaultCORSHeaders
+	}
+	for i := range allowed {
+		if allowed[i] == "*" || strings.EqualFold(allowed[i], h) {
+			return true
+		}
+	}
+	return false
+}
+
+// setOriginHeaders sets response headers allowing request from origin.
+func (p *CORSPolicy) setOriginHeaders(fctx *fasthttp.RequestCtx, origin string) {
+	if p.isWildcardOrigin() {
+		fctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowOrigin, "*")
+	} else {
+		fctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowOrigin, origin)
+	}
+	if p.AllowCredentials {
+		fctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowCredentials, "true")
+	}
+}
+
+// applyCORS sets CORS headers of the actual (not preflight) request if its origin is allowed.
+func (e *Endpoint) applyCORS(fctx *fasthttp.RequestCtx) {
+	// response depends on origin unless any origin is allowed, even if
+	// the origin is missing or disallowed.
+	if !e.cors.isWildcardOrigin() {
+		fctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderOrigin)
+	}
+
+	origin := fctx.Request.Header.Peek(fasthttp.HeaderOrigin)
+	if len(origin) == 0 || !e.cors.isOriginAllowed(string(origin)) {
+		return
+	}
+
+	e.cors.setOriginHeaders(fctx, string(origin))
+	if len(e.cors.ExposedHeaders) > 0 {
+		fctx.Response.Header.Set(fasthttp.HeaderAccessControlExposeHeaders, strings.Join(e.cors.ExposedHeaders, ", "))
+	}
+}
+
+// registerPreflightHandlers registers handlers of OPTIONS requests for all
+// paths having endpoints with CORS policy.
+func (v *Vatel) registerPreflightHandlers(mux *router.Router, l *zerolog.Logger) {
+	paths := make(map[string][]*Endpoint)
+	var order []string
+	for i := range v.ep {
+		e := &v.ep[i]
+		if e.cors == nil {
+			continue
+		}
+		if _, ok := paths[e.Path]; !ok {
+			order = append(order, e.Path)
+		}
+		paths[e.Path] = append(paths[e.Path], e)
+	}
+
+	for _, p := range order {
+		mux.Handle("OPTIONS", p, preflightHandler(paths[p]))
+		l.Info().Str("method", "OPTIONS").Str("path", p).Msg("preflight handler registered")
+	}
+}
+
+// preflightHandler returns handler of preflight requests to endpoints ep having the same path.
+func preflightHandler(ep []*Endpoint) func(*fasthttp.RequestCtx) {
+	return func(fctx *fasthttp.RequestCtx) {
+
+		fctx.Response.Header.Add(fasthttp.HeaderVary, "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+
+		origin := string(fctx.Request.Header.Peek(fasthttp.HeaderOrigin))
+		method := strings.ToUpper(string(fctx.Request.Header.Peek(fasthttp.HeaderAccessControlRequestMethod)))
+
+		var e *Endpoint
+		var methods []string
+		for i := range ep {
+			methods = append(methods, ep[i].Method)
+			if ep[i].Method == method {
+				e = ep[i]
+			}
+		}
+
+		if origin == "" || e == nil || !e.cors.isOriginAllowed(origin) {
+			fctx.SetStatusCode(fasthttp.StatusForbidden)
+			return
+		}
+
+		p := e.cors
+		if len(p.AllowedMethods) > 0 {
+			methods = p.AllowedMethods
+			allowed := false
+			for i := range methods {
+				allowed = allowed || strings.EqualFold(methods[i], method)
+			}
+			if !allowed {
+				fctx.SetStatusCode(fasthttp.StatusForbidden)
+				return
+			}
+		}
+
+		var headers []string
+		for _, h := range strings.Split(string(fctx.Request.Header.Peek(fasthttp.HeaderAccessControlRequestHeaders)), ",") {
+			if h = strings.TrimSpace(h); h == "" {
+				continue
+			}
+			if !p.isHeaderAllowed(h) {
+				fctx.SetStatusCode(fasthttp.StatusForbidden)
+				return
+			}
+			headers = append(headers, h)
+		}
+
+		p.setOriginHeaders(fctx, origin)
+		fctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowMethods, strings.Join(methods, ", "))
+		if len(headers) > 0 {
+			fctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowHeaders, strings.Join(headers, ", "))
+		}
+		if p.MaxAge > 0 {
+			fctx.Response.Header.Set(fasthttp.HeaderAccessControlMaxAge, strconv.Itoa(int(p.MaxAge.Seconds())))
+		}
+		fctx.SetStatusCode(fasthttp.StatusNoContent)
+	}
+}
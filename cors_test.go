@@ -0,0 +1,116 @@
+package vatel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCORSPolicy_isOriginAllowed(t *testing.T) {
+	p := CORSPolicy{AllowedOrigins: []string{"https://app.example.org", "https://*.example.com"}}
+
+	for origin, expected := range map[string]bool{
+		"https://app.example.org": true,
+		"https://APP.example.org": true,
+		"https://a.example.com":   true,
+		"https://a.b.example.com": true,
+		"https://example.com":     false,
+		"http://a.example.com":    false,
+		"https://aexample.com":    false,
+		"https://evil.org":        false,
+	} {
+		if p.isOriginAllowed(origin) != expected {
+			t.Errorf("%s: expected %t", origin, expected)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+
+	v := NewVatel(WithCORS(&CORSPolicy{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowedHeaders:   []string{"Content-Type", "X-Request-Id"},
+		ExposedHeaders:   []string{"X-Total"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	v.DisableAuthorizer()
+	v.Add(endpoints{
+		{Method: "GET", Path: "/customers", Controller: func() Handler { return &testSearchController{} }},
+		{Method: "POST", Path: "/customers", Controller: func() Handler { return &testEchoController{} }},
+		{Method: "GET", Path: "/public", CORS: &CORSPolicy{AllowedOrigins: []string{"*"}}, Controller: func() Handler { return &testNopController{} }},
+	})
+
+	r := router.New()
+	l := zerolog.Nop()
+	if err := v.BuildHandlers(r, &l); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, uri string, headers ...string) *fasthttp.RequestCtx {
+		var fctx fasthttp.RequestCtx
+		fctx.Request.Header.SetMethod(method)
+		fctx.Request.SetRequestURI(uri)
+		for i := 0; i < len(headers); i += 2 {
+			fctx.Request.Header.Set(headers[i], headers[i+1])
+		}
+		r.Handler(&fctx)
+		return &fctx
+	}
+
+	fctx := request("OPTIONS", "/customers", "Origin", "https://app.example.com",
+		"Access-Control-Request-Method", "POST", "Access-Control-Request-Headers", "content-type, x-request-id")
+	h := &fctx.Response.Header
+	if fctx.Response.StatusCode() != 204 ||
+		string(h.Peek("Access-Control-Allow-Origin")) != "https://app.example.com" ||
+		string(h.Peek("Access-Control-Allow-Methods")) != "GET, POST" ||
+		string(h.Peek("Access-Control-Allow-Headers")) != "content-type, x-request-id" ||
+		string(h.Peek("Access-Control-Allow-Credentials")) != "true" ||
+		string(h.Peek("Access-Control-Max-Age")) != "600" {
+		t.Errorf("unexpected preflight response: %d %s", fctx.Response.StatusCode(), h.String())
+	}
+
+	for _, headers := range [][]string{
+		{"Origin", "https://evil.org", "Access-Control-Request-Method", "GET"},
+		{"Origin", "https://app.example.com", "Access-Control-Request-Method", "DELETE"},
+		{"Origin", "https://app.example.com", "Access-Control-Request-Method", "GET", "Access-Control-Request-Headers", "X-Secret"},
+	} {
+		if fctx := request("OPTIONS", "/customers", headers...); fctx.Response.StatusCode() != 403 || len(fctx.Response.Header.Peek("Access-Control-Allow-Origin")) != 0 {
+			t.Errorf("%v: preflight must be rejected, got %d", headers, fctx.Response.StatusCode())
+		}
+	}
+
+	fctx = request("GET", "/customers", "Origin", "https://app.example.com")
+	if string(fctx.Response.Header.Peek("Access-Control-Allow-Origin")) != "https://app.example.com" ||
+		string(fctx.Response.Header.Peek("Access-Control-Expose-Headers")) != "X-Total" ||
+		string(fctx.Response.Header.Peek("Vary")) != "Origin" {
+		t.Errorf("unexpected response: %s", fctx.Response.Header.String())
+	}
+
+	// shared caches must not serve the response to other origins.
+	for _, headers := range [][]string{{"Origin", "https://evil.org"}, nil} {
+		fctx = request("GET", "/customers", headers...)
+		if len(fctx.Response.Header.Peek("Access-Control-Allow-Origin")) != 0 || string(fctx.Response.Header.Peek("Vary")) != "Origin" {
+			t.Errorf("%v: unexpected response: %s", headers, fctx.Response.Header.String())
+		}
+	}
+
+	fctx = request("GET", "/public", "Origin", "https://any.org")
+	if string(fctx.Response.Header.Peek("Access-Control-Allow-Origin")) != "*" || len(fctx.Response.Header.Peek("Vary")) != 0 {
+		t.Errorf("overridden policy expected: %s", fctx.Response.Header.String())
+	}
+}
+
+func TestCORSPolicy_validate(t *testing.T) {
+	v := NewVatel(WithCORS(&CORSPolicy{AllowedOrigins: []string{"https://app.example.com", "*"}, AllowCredentials: true}))
+	v.DisableAuthorizer()
+	v.Add(endpoints{{Method: "GET", Path: "/customers", Controller: func() Handler { return &testSearchController{} }}})
+
+	l := zerolog.Nop()
+	if err := v.BuildHandlers(router.New(), &l); err == nil {
+		t.Error("error expected for credentials allowed to any origin")
+	}
+}
@@ -0,0 +1,103 @@
+package vatel
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// DebugFlags defines what request data is written to the log.
+type DebugFlags struct {
+	// In turns on logging of request body and decoded input.
+	In bool `json:"in"`
+
+	// Out turns on logging of response body and result.
+	Out bool `json:"out"`
+}
+
+// DebugList implements RequestDebugger. It turns on logging of request and
+// response data for users matched by UUID, login or role. The list can be
+// changed at runtime.
+//
+//	dl := vatel.NewDebugList()
+//	v.SetRequestDebugger(dl)
+//	...
+//	dl.SetLogin("john", vatel.DebugFlags{In: true, Out: true})
+type DebugList struct {
+	mu     sync.RWMutex
+	users  map[uuid.UUID]DebugFlags
+	logins map[string]DebugFlags
+	roles  map[int]DebugFlags
+}
+
+// NewDebugList returns empty DebugList.
+func NewDebugList() *DebugList {
+	return &DebugList{
+		users:  make(map[uuid.UUID]DebugFlags),
+		logins: make(map[string]DebugFlags),
+		roles:  make(map[int]DebugFlags),
+	}
+}
+
+// SetUser sets debug flags of the user. Zero flags remove the user from the list.
+func (dl *DebugList) SetUser(user uuid.UUID, f DebugFlags) {
+	dl.mu.Lock()
+	if f == (DebugFlags{}) {
+		delete(dl.users, user)
+	} else {
+		dl.users[user] = f
+	}
+	dl.mu.Unlock()
+}
+
+// SetLogin sets debug flags of the login. Zero flags remove the login from the list.
+func (dl *DebugList) SetLogin(login string, f DebugFlags) {
+	dl.mu.Lock()
+	if f == (DebugFlags{}) {
+		delete(dl.logins, login)
+	} else {
+		dl.logins[login] = f
+	}
+	dl.mu.Unlock()
+}
+
+// SetRole sets debug flags of all users having the role. Zero flags remove the role from the list.
+func (dl *DebugList) SetRole(role int, f DebugFlags) {
+	dl.mu.Lock()
+	if f == (DebugFlags{}) {
+		delete(dl.roles, role)
+	} else {
+		dl.roles[role] = f
+	}
+	dl.mu.Unlock()
+}
+
+// Reset removes all users, logins and roles from the list.
+func (dl *DebugList) Reset() {
+	dl.mu.Lock()
+	dl.users = make(map[uuid.UUID]DebugFlags)
+	dl.logins = make(map[string]DebugFlags)
+	dl.roles = make(map[int]DebugFlags)
+	dl.mu.Unlock()
+}
+
+// IsDebugRequired implements RequestDebugger. Flags of all matched
+// user, login and role are combined.
+func (dl *DebugList) IsDebugRequired(tp TokenPayloader) (in, out bool) {
+	if tp == nil {
+		return false, false
+	}
+
+	dl.mu.RLock()
+	defer dl.mu.RUnlock()
+
+	if len(dl.users)+len(dl.logins)+len(dl.roles) == 0 {
+		return false, false
+	}
+
+	for _, f := range []DebugFlags{dl.users[tp.User()], dl.logins[tp.Login()], dl.roles[tp.Role()]} {
+		in = in || f.In
+		out = out || f.Out
+	}
+	return in, out
+}
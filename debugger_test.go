@@ -0,0 +1,112 @@
+package vatel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+type testPayload struct {
+	user  uuid.UUID
+	login string
+	role  int
+}
+
+func (p *testPayload) User() uuid.UUID    { return p.user }
+func (p *testPayload) Login() string      { return p.login }
+func (p *testPayload) Role() int          { return p.role }
+func (p *testPayload) Perms() []byte      { return []byte{0xff} }
+func (p *testPayload) Extra() interface{} { return nil }
+func (p *testPayload) Debug() bool        { return false }
+
+type testToken struct{ p testPayload }
+
+func (t *testToken) SystemPayload() map[string]interface{} { return nil }
+func (t *testToken) ApplicationPayload() TokenPayloader    { return &t.p }
+
+// testAuth implements Authorizer, TokenDecoder and PermissionManager.
+// Token is the login of the user.
+type testAuth struct{}
+
+func (testAuth) IsAllowed(requestPerms []byte, endpointPerms ...uint) (bool, error) { return true, nil }
+func (testAuth) PermissionBitPos(perm string) (uint, bool)                          { return 1, true }
+func (testAuth) Decode(encodedToken []byte) (Tokener, error) {
+	return &testToken{p: testPayload{login: string(encodedToken), role: 2}}, nil
+}
+
+func newTestVatel(optFunc ...func(*Option)) *Vatel {
+	v := NewVatel(optFunc...)
+	v.SetAuthorizer(testAuth{})
+	v.SetTokenDecoder(testAuth{})
+	v.SetPermissionManager(testAuth{})
+	return v
+}
+
+func TestDebugList(t *testing.T) {
+	dl := NewDebugList()
+	u := uuid.New()
+
+	dl.SetUser(u, DebugFlags{In: true})
+	dl.SetRole(2, DebugFlags{Out: true})
+
+	if in, out := dl.IsDebugRequired(&testPayload{user: u, role: 2}); !in || !out {
+		t.Errorf("expected in and out, got %t %t", in, out)
+	}
+	if in, out := dl.IsDebugRequired(&testPayload{role: 1}); in || out {
+		t.Errorf("expected no debug, got %t %t", in, out)
+	}
+
+	dl.SetRole(2, DebugFlags{})
+	if in, out := dl.IsDebugRequired(&testPayload{user: u, role: 2}); !in || out {
+		t.Errorf("expected in only, got %t %t", in, out)
+	}
+}
+
+func TestEndpoint_requestDebugger(t *testing.T) {
+
+	dl := NewDebugList()
+	dl.SetLogin("john", DebugFlags{In: true, Out: true})
+
+	for _, c := range []struct {
+		login      string
+		noInputLog bool
+		expected   []string
+		unexpected []string
+	}{
+		{"john", false, []string{`"requestBody":{"name":"x"}`, `"respBody":`, `"level":"info"`}, nil},
+		{"john", true, []string{`"respBody":`}, []string{`requestBody`}},
+		{"mary", false, nil, []string{`requestBody`, `respBody`}},
+	} {
+		v := newTestVatel()
+		v.SetRequestDebugger(dl)
+
+		e := Endpoint{Method: "POST", Path: "/echo", Perms: []string{"Echo"}, LogOptions: LogSilent, NoInputLog: c.noInputLog,
+			Controller: func() Handler { return &testEchoController{} }}
+		if err := e.compile(v); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		l := zerolog.New(&buf).Level(zerolog.InfoLevel)
+
+		var fctx fasthttp.RequestCtx
+		fctx.Request.Header.Set("Authorization", c.login)
+		fctx.Request.SetBody([]byte(`{"name":"x"}`))
+		e.handler(&l)(&fctx)
+
+		for _, s := range c.expected {
+			if !strings.Contains(buf.String(), s) {
+				t.Errorf("%s: %s expected in log: %s", c.login, s, buf.String())
+			}
+		}
+		for _, s := range c.unexpected {
+			if strings.Contains(buf.String(), s) {
+				t.Errorf("%s: %s unexpected in log: %s", c.login, s, buf.String())
+			}
+		}
+	}
+}
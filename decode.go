@@ -0,0 +1,197 @@
+package vatel
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axkit/date"
+	"github.com/axkit/errors"
+	"github.com/google/uuid"
+)
+
+// ValueDecoder converts string taken from URL to the value of specific type.
+type ValueDecoder func(s string) (interface{}, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[reflect.Type]ValueDecoder{}
+)
+
+// RegisterDecoder registers decoder of URL query and path parameters for the
+// type of sample. Value returned by decoder must have the same type as sample,
+// otherwise decoding fails.
+//
+// Registered decoders have priority over built-in ones.
+//
+//	vatel.RegisterDecoder(Money{}, func(s string) (interface{}, error) {
+//		return ParseMoney(s)
+//	})
+func RegisterDecoder(sample interface{}, f ValueDecoder) {
+	decodersMu.Lock()
+	decoders[reflect.TypeOf(sample)] = f
+	decodersMu.Unlock()
+}
+
+func lookupDecoder(t reflect.Type) (ValueDecoder, bool) {
+	decodersMu.RLock()
+	f, ok := decoders[t]
+	decodersMu.RUnlock()
+	return f, ok
+}
+
+var daterType = reflect.TypeOf((*Dater)(nil)).Elem()
+
+// isDecodableType returns true if the value of type t is decoded from a single string,
+// even though it's a struct, an array or a slice.
+func isDecodableType(t reflect.Type) bool {
+	if _, ok := lookupDecoder(t); ok {
+		return true
+	}
+	pt := reflect.PtrTo(t)
+	return isScalarType(t) || pt.Implements(daterType) || pt.Implements(textUnmarshalerType)
+}
+
+// decodeField assigns vals taken from URL to the field v.
+//
+// Slices are populated by all values, every value can hold several
+// comma separated items: ?id=1&id=2 and ?id=1,2 are the same.
+// Other types take the first value.
+func decodeField(v reflect.Value, vals []string) error {
+
+	if len(vals) == 0 {
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr && !isDecodableType(v.Type()) {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeField(v.Elem(), vals)
+	}
+
+	if v.Kind() == reflect.Slice && !isDecodableType(v.Type()) && v.Type().Elem().Kind() != reflect.Uint8 {
+		var items []string
+		for i := range vals {
+			items = append(items, strings.Split(vals[i], ",")...)
+		}
+
+		res := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i := range items {
+			if err := decodeValue(res.Index(i), strings.TrimSpace(items[i])); err != nil {
+				return err
+			}
+		}
+		v.Set(res)
+		return nil
+	}
+
+	return decodeValue(v, vals[0])
+}
+
+// decodeValue converts s to the type of v and assigns it.
+func decodeValue(v reflect.Value, s string) error {
+
+	if f, ok := lookupDecoder(v.Type()); ok {
+		res, err := f(s)
+		if err != nil {
+			return err
+		}
+		if res == nil || !reflect.TypeOf(res).AssignableTo(v.Type()) {
+			return errors.New("decoder returned value of unexpected type").
+				Set("type", v.Type().String()).Set("resultType", fmt.Sprintf("%T", res))
+		}
+		v.Set(reflect.ValueOf(res))
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", s); err != nil {
+				return err
+			}
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case dateType:
+		d, err := date.Parse(s)
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(d))
+		return nil
+	case uuidType:
+		u, err := uuid.Parse(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(u))
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(v.Elem(), s)
+	}
+
+	if v.CanAddr() {
+		switch x := v.Addr().Interface().(type) {
+		case Dater:
+			res, err := x.Parse(s)
+			if err != nil {
+				return err
+			}
+			x.Set(res)
+			return nil
+		case encoding.TextUnmarshaler:
+			return x.UnmarshalText([]byte(s))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		k, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(k)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		k, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(k)
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Float32, reflect.Float64:
+		k, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(k)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return errors.ValidationFailed("unsupported type").Set("val", s).Set("kind", v.Kind().String())
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package vatel
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"path"
@@ -11,8 +12,8 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/axkit/date"
 	"github.com/axkit/errors"
+	"github.com/golangkit/vatel/codec"
 	"github.com/golangkit/vatel/jsonmask"
 	"github.com/rs/zerolog"
 
@@ -41,24 +42,38 @@ const (
 	LogConfidential           = LogExit
 )
 
+// MiddlewarePos defines the stage of request processing when middleware is called.
 type MiddlewarePos int
 
 const (
+	// BeforeAuthorization middlewares are called before access token check.
 	BeforeAuthorization MiddlewarePos = iota
+
+	// AfterAuthorization middlewares are called after request decoding, before controller.
 	AfterAuthorization
+
+	// OnSuccessResponse middlewares are called after response is written.
 	OnSuccessResponse
+
+	// OnErrorResponse middlewares are called after error response is written.
+	// The error is available by Context.ResponseError. Middleware can replace
+	// status code, headers and body of the response.
 	OnErrorResponse
 )
 
-type middlewareSet [3][]func(Context) error
+type middlewareSet [OnErrorResponse + 1][]func(Context) error
 
 // Endpoint describes a REST endpoint attributes and related request Handler.
 type Endpoint struct {
 	staticLoggingLevel bool
 	verboseError       bool
 	logRequestID       bool
+	internal           bool
 	LogOptions         LogOption
 
+	// check validates configuration of built-in endpoints on compile.
+	check func(v *Vatel) error
+
 	// Method holds HTTP method name (e.g GET, POST, PUT, DELETE).
 	Method string
 
@@ -77,6 +92,8 @@ type Endpoint struct {
 	// ResponseContentType by default has "application/json; charset: utf-8;"
 	ResponseContentType string
 	responseContentType []byte
+	respMediaType       string
+	respCodec           Codec
 
 	// NoInputLog defines debug logging rule for request data. If true, endpoint request body
 	// will not be written to the log. (i.e authentication endpoint).
@@ -86,12 +103,70 @@ type Endpoint struct {
 	// will not be written to the log. (i.e authentication  endpoint)
 	NoResultLog bool
 
+	// ManualStatusCode defines that response status code is set by controller
+	// and SuccessStatusCode is not applied.
 	ManualStatusCode bool
 
-	//
+	// Timeout limits request processing time. Request's context.Context
+	// (see Context.Context) is cancelled and status 504 is returned
+	// when it's exceeded. Context of event stream (see EventSink.Context)
+	// is cancelled as well. Zero means no limit.
+	Timeout time.Duration
+
+	// baseCtx is the parent of contexts of requests (see WithBaseContext).
+	baseCtx context.Context
+
+	// RateLimit limits number of requests to the endpoint. Nil if unlimited.
+	RateLimit *RateLimit
+
+	// Idempotent turns on support of request header Idempotency-Key for POST, PUT
+	// and PATCH endpoints. Response of succeeded request is stored and replayed
+	// to the requests of the same user having the same key without calling controller.
+	Idempotent bool
+
+	// IdempotencyTTL is the period of keeping responses of idempotent endpoint.
+	// Default is DefaultIdempotencyTTL.
+	IdempotencyTTL time.Duration
+
+	// CORS overrides CORS policy set by WithCORS.
+	CORS *CORSPolicy
+	cors *CORSPolicy
+
+	// EventKeepAlive is the period of sending keep-alive comments if controller
+	// implements EventStreamer. Default is DefaultEventKeepAlive.
+	EventKeepAlive time.Duration
+	isEventStream  bool
+
+	// WebSocket defines keep-alive and limits of connections if controller
+	// implements MessageHandler.
+	WebSocket   WebSocketOptions
+	isWebSocket bool
+	ws          *wsRegistry
+
+	isResultStream bool
+	isFile         bool
+
+	// Upload defines limits and storage of files if Input struct has fields
+	// with tag "form". Such endpoint accepts multipart/form-data requests only.
+	Upload      *UploadPolicy
+	upload      UploadPolicy
+	isMultipart bool
+
+	// TokenExtractor overrides the way of taking access token set by
+	// Vatel.SetTokenExtractor.
+	TokenExtractor TokenExtractor
+
+	// Cache defines caching of GET endpoint's responses. Nil if responses are not cached.
+	Cache *CachePolicy
+
+	// SuccessStatusCode is the status code of successful response. If zero, 204 is
+	// used if controller does not implement Resulter, 201 for POST, 200 otherwise.
+	// Default status code is not applied if controller sets status code itself.
 	SuccessStatusCode int
+	successStatusCode int
 
 	isPathParametrized    bool
+	pathParams            []string
 	isURLQueryExpected    bool
 	isRequestBodyExpected bool
 	hasRespBody           bool
@@ -102,9 +177,17 @@ type Endpoint struct {
 	pm            PermissionManager
 	rd            RequestDebugger
 	rtc           RevokeTokenChecker
+	rls           RateLimitStore
+	ids           IdempotencyStore
+	rc            ResponseCache
 	perms         []uint
 
+	// Middlewares holds endpoint's middlewares. They are called after global
+	// and group's middlewares.
+	Middlewares map[MiddlewarePos][]func(Context) error
+
 	middlewares middlewareSet
+	group       *Group
 
 	jm           JsonMasker
 	inputFields  jsonmask.Fields
@@ -112,6 +195,7 @@ type Endpoint struct {
 
 	ala Alarmer
 	mr  MetricReporter
+	ifr InFlightReporter
 }
 
 // NewEndpoint builds Endpoint.
@@ -171,10 +255,22 @@ type Resulter interface {
 //
 // If there is URL params and variables like /customer/{id}?sortBy=name&balanceAbove=100
 // methods Param and Input can return reference to the same struct.
+//
+// If path has a single parameter (e.g. /customers/{id}), Param can return
+// reference to a single variable instead of struct.
 type Paramer interface {
 	Param() interface{}
 }
 
+// AddMiddleware adds endpoint's middlewares. They are called after
+// middlewares added by Vatel.AddMiddleware in the same order.
+func (e *Endpoint) AddMiddleware(pos MiddlewarePos, f ...func(Context) error) {
+	if e.Middlewares == nil {
+		e.Middlewares = make(map[MiddlewarePos][]func(Context) error)
+	}
+	e.Middlewares[pos] = append(e.Middlewares[pos], f...)
+}
+
 // func writeErrorResponse(ctx Context, verbose bool, zc *zerolog.Context, err error) {
 // 	if err == nil {
 // 		return
@@ -258,9 +354,20 @@ func (e *Endpoint) writeErrorResponse(ctx Context, verbose bool, zc *zerolog.Con
 		z = z.Interface(string(key), v)
 	})
 
+	// errors.ToServerJSON removes root level fields (i.e. "reason") from the error
+	// after formatting. They are restored to be sent to the client.
+	var reason interface{}
+	if ce != nil {
+		reason, _ = ce.Get("reason")
+	}
+
 	zl := z.RawJSON("err", errors.ToServerJSON(err)).Logger()
 	zl.Error().Msg("request failed")
 
+	if reason != nil {
+		ce.Set("reason", reason)
+	}
+
 	ctx.SetContentType([]byte("application/json; charset=utf-8"))
 	ctx.SetStatusCode(statusCode)
 
@@ -269,14 +376,23 @@ func (e *Endpoint) writeErrorResponse(ctx Context, verbose bool, zc *zerolog.Con
 		ff = errors.AddStack | errors.AddFields | errors.AddWrappedErrors
 	}
 
-	_, xerr := ctx.BodyWriter().Write(errors.ToJSON(err, ff))
+	ctx.SetBody(errors.ToJSON(err, ff))
 
-	if xerr != nil {
-		//zl.With().Error().RawJSON("err", errors.ToServerJSON(xerr)).Msg("writing http response failed")
+	// error middlewares can rewrite status code, headers and body of the response.
+	if len(e.middlewares[OnErrorResponse]) > 0 {
+		if vc, ok := ctx.(*VatelContext); ok {
+			vc.err = err
+		}
+		for i := range e.middlewares[OnErrorResponse] {
+			if xerr := e.middlewares[OnErrorResponse][i](ctx); xerr != nil {
+				zl.Error().RawJSON("middlewareErr", errors.ToServerJSON(xerr)).Msg("error response middleware failed")
+				break
+			}
+		}
 	}
 
 	if e.mr != nil {
-		e.mr.ReportMetric(e.Method, e.Path, statusCode, time.Since(ctx.RequestCtx().Time()).Seconds(), len(ctx.RequestCtx().Response.Body()))
+		e.mr.ReportMetric(e.Method, e.Path, ctx.RequestCtx().Response.StatusCode(), time.Since(ctx.RequestCtx().Time()).Seconds(), len(ctx.RequestCtx().Response.Body()))
 	}
 
 	if e.ala != nil && statusCode >= 500 {
@@ -295,6 +411,11 @@ func (e *Endpoint) handler(l *zerolog.Logger) func(*fasthttp.RequestCtx) {
 			zco zerolog.Context
 		)
 
+		if e.ifr != nil {
+			e.ifr.RequestStarted(e.Method, e.Path)
+			defer e.ifr.RequestFinished(e.Method, e.Path)
+		}
+
 		verbose := e.verboseError
 
 		var lo LogOption
@@ -303,6 +424,10 @@ func (e *Endpoint) handler(l *zerolog.Logger) func(*fasthttp.RequestCtx) {
 		} else {
 			lo = e.LogOptions
 		}
+		lo = e.allowedLogOption(lo)
+
+		// requests of debugged users are logged with level info.
+		level := zerolog.DebugLevel
 
 		zco = l.With().Str("client", realip.FromRequest(fctx))
 		if e.logRequestID {
@@ -310,8 +435,20 @@ func (e *Endpoint) handler(l *zerolog.Logger) func(*fasthttp.RequestCtx) {
 		}
 		zc = zco
 
+		if e.cors != nil {
+			e.applyCORS(fctx)
+		}
+
 		ctx := NewContext(fctx)
 
+		// context of streamed result is cancelled when the stream ends.
+		cancel := ctx.(*VatelContext).initContext(e.baseCtx, e.Timeout)
+		defer func() {
+			if cancel != nil {
+				cancel()
+			}
+		}()
+
 		for i := range e.middlewares[BeforeAuthorization] {
 			if err := e.middlewares[BeforeAuthorization][i](ctx); err != nil {
 				e.writeErrorResponse(ctx, verbose, &zc, err)
@@ -319,8 +456,13 @@ func (e *Endpoint) handler(l *zerolog.Logger) func(*fasthttp.RequestCtx) {
 			}
 		}
 
-		// inDebug := e.LogOptions&ConfidentialInput != ConfidentialInput
-		// outDebug := e.LogOptions&ConfidentialOutput != ConfidentialOutput
+		// requests limited by IP address are throttled before token decoding.
+		if e.RateLimit != nil && e.RateLimit.Key == RateLimitByIP {
+			if err := e.checkRateLimit(ctx, nil); err != nil {
+				e.writeErrorResponse(ctx, verbose, &zc, err)
+				return
+			}
+		}
 
 		if len(e.Perms) > 0 && e.auth != nil {
 			switch len(e.Perms) {
@@ -332,20 +474,77 @@ func (e *Endpoint) handler(l *zerolog.Logger) func(*fasthttp.RequestCtx) {
 				zc = zc.Strs("perms", e.Perms)
 			}
 
-			token, err := e.authorize(fctx)
+			at, src := e.TokenExtractor.ExtractToken(fctx)
+			if len(at) > 0 {
+				zc = zc.Str("tokenSource", src).Str("token", maskToken(at))
+			}
+
+			token, err := e.authorize(at)
 			if err != nil {
 				e.writeErrorResponse(ctx, verbose, &zc, err)
 				return
 			}
 
+			t := token.ApplicationPayload()
 			if e.rd != nil {
-				//	inDebug, outDebug = e.rd.IsDebugRequired(token.ApplicationPayload())
+				if in, out := e.rd.IsDebugRequired(t); in || out {
+					lo = e.allowedLogOption(lo | debugLogOption(in, out))
+					level = zerolog.InfoLevel
+				}
 			}
-			t := token.ApplicationPayload()
 			ctx.SetTokenPayload(t)
 			verbose = verbose || t.Debug()
 		}
 
+		if e.RateLimit != nil && e.RateLimit.Key != RateLimitByIP {
+			if err := e.checkRateLimit(ctx, ctx.TokenPayload()); err != nil {
+				e.writeErrorResponse(ctx, verbose, &zc, err)
+				return
+			}
+		}
+
+		// succeeded is used to save response of idempotent request.
+		succeeded := false
+
+		if e.Idempotent {
+			if key := e.idempotencyKey(fctx, ctx.TokenPayload()); key != "" {
+				replayed, err := e.beginIdempotent(ctx, key)
+				if err != nil {
+					e.writeErrorResponse(ctx, verbose, &zc, err)
+					return
+				}
+				if replayed {
+					zl := zc.Logger()
+					zl.WithLevel(level).Int("status", fctx.Response.StatusCode()).Msg("response replayed")
+					if e.mr != nil {
+						e.mr.ReportMetric(e.Method, e.Path, fctx.Response.StatusCode(), time.Since(fctx.Time()).Seconds(), len(fctx.Response.Body()))
+					}
+					return
+				}
+				defer func() {
+					if err := e.finishIdempotent(fctx, key, succeeded); err != nil {
+						zl := zc.Logger()
+						zl.Error().Str("err", err.Error()).Msg("idempotency key storing failed")
+					}
+				}()
+			}
+		}
+
+		var cacheKey string
+		if e.rc != nil && !fctx.QueryArgs().GetBool("description") {
+			// not acceptable request is rejected below.
+			_, _, mt, _ := e.responseCodec(fctx)
+			cacheKey = e.cacheKey(fctx, ctx.TokenPayload(), mt)
+			if mt != "" && e.replayCachedResponse(fctx, cacheKey) {
+				zl := zc.Logger()
+				zl.WithLevel(level).Int("status", fctx.Response.StatusCode()).Msg("cached response")
+				if e.mr != nil {
+					e.mr.ReportMetric(e.Method, e.Path, fctx.Response.StatusCode(), time.Since(fctx.Time()).Seconds(), len(fctx.Response.Body()))
+				}
+				return
+			}
+		}
+
 		if fctx.QueryArgs().GetBool("description") {
 			if err := e.handleDescription(ctx); err != nil {
 				e.writeErrorResponse(ctx, verbose, &zc, err)
@@ -353,11 +552,45 @@ func (e *Endpoint) handler(l *zerolog.Logger) func(*fasthttp.RequestCtx) {
 			return
 		}
 
+		if e.isWebSocket {
+			if err := checkWebSocketHandshake(fctx); err != nil {
+				e.writeErrorResponse(ctx, verbose, &zc, err)
+				return
+			}
+			if !e.isWebSocketOriginAllowed(fctx) {
+				e.writeErrorResponse(ctx, verbose, &zc, ErrWebSocketOriginForbidden.Capture())
+				return
+			}
+		}
+
+		var (
+			rc  Codec
+			rct []byte
+			rmt string
+		)
+		if e.hasRespBody {
+			var err error
+			if rc, rct, rmt, err = e.responseCodec(fctx); err != nil {
+				e.writeErrorResponse(ctx, verbose, &zc, err)
+				return
+			}
+		}
+		if e.isResultStream {
+			var err error
+			if rmt, err = streamMediaType(fctx); err != nil {
+				e.writeErrorResponse(ctx, verbose, &zc, err)
+				return
+			}
+		}
+
 		zc, h, err := e.initController(fctx, lo, zc)
 		if err != nil {
 			e.writeErrorResponse(ctx, verbose, &zc, err)
 			return
 		}
+		if e.isMultipart {
+			defer e.removeUploads(h.(Inputer).Input(), zc)
+		}
 
 		for i := range e.middlewares[AfterAuthorization] {
 			if err := e.middlewares[AfterAuthorization][i](ctx); err != nil {
@@ -372,26 +605,68 @@ func (e *Endpoint) handler(l *zerolog.Logger) func(*fasthttp.RequestCtx) {
 			})
 
 			zl := zc.Logger()
-			zl.Debug().Msg("new request")
+			zl.WithLevel(level).Msg("new request")
 			zc = zco
 		}
 
-		if err = h.Handle(ctx); err != nil {
+		err = h.Handle(ctx)
+		if e.Timeout > 0 && ctx.Context().Err() == context.DeadlineExceeded {
+			if err != nil {
+				zc = zc.Str("handlerErr", err.Error())
+			}
+			err = ErrDeadlineExceeded.Capture()
+		}
+		if err != nil {
 			e.writeErrorResponse(ctx, verbose, &zc, err)
 			return
 		}
 
+		if e.isEventStream || e.isWebSocket || e.isResultStream || e.isFile {
+			switch {
+			case e.isFile:
+				if err := e.writeFile(fctx, h.(FileResulter).File(), lo, level, zc); err != nil {
+					e.writeErrorResponse(ctx, verbose, &zc, err)
+					return
+				}
+			case e.isEventStream:
+				e.streamEvents(fctx, h.(EventStreamer), level, zc)
+			case e.isWebSocket:
+				e.upgradeWebSocket(ctx, h.(MessageHandler), verbose, level, zc)
+			default:
+				if !e.ManualStatusCode {
+					e.setSuccessStatusCode(fctx)
+				}
+				e.streamResult(fctx, h.(StreamResulter), rmt, lo, level, zc, cancel)
+				cancel = nil
+			}
+			for i := range e.middlewares[OnSuccessResponse] {
+				if err := e.middlewares[OnSuccessResponse][i](ctx); err != nil {
+					e.writeErrorResponse(ctx, verbose, &zc, err)
+					return
+				}
+			}
+			return
+		}
+
+		if !e.ManualStatusCode {
+			e.setSuccessStatusCode(fctx)
+		}
+
 		if e.hasRespBody {
-			if err := e.writeResponse(ctx, lo, h.(Resulter).Result(), &zc); err != nil {
+			if err := e.writeResponse(ctx, lo, h.(Resulter).Result(), rc, rct, rmt, &zc); err != nil {
 				e.writeErrorResponse(ctx, verbose, &zc, err)
 				return
 			}
 		}
 
+		if e.Cache != nil {
+			e.applyCachePolicy(fctx, h, cacheKey)
+		}
+
 		dur := time.Since(fctx.Time())
 		if lo&LogExit == LogExit {
 			msg := "completed"
-			if e.LogOptions&LogEnter != LogEnter {
+			if lo&LogEnter != LogEnter {
 				msg = "processed"
 			}
 			ctx.VisitUserValues(func(key []byte, v interface{}) {
@@ -403,11 +678,11 @@ func (e *Endpoint) handler(l *zerolog.Logger) func(*fasthttp.RequestCtx) {
 			})
 
 			zl := zc.Logger()
-			zl.Debug().Str("dur", dur.String()).Msg(msg)
+			zl.WithLevel(level).Int("status", fctx.Response.StatusCode()).Str("dur", dur.String()).Msg(msg)
 		}
 
 		if e.mr != nil {
-			e.mr.ReportMetric(e.Method, e.Path, 200, dur.Seconds(), len(fctx.Response.Body()))
+			e.mr.ReportMetric(e.Method, e.Path, fctx.Response.StatusCode(), dur.Seconds(), len(fctx.Response.Body()))
 		}
 
 		for i := range e.middlewares[OnSuccessResponse] {
@@ -416,12 +691,15 @@ func (e *Endpoint) handler(l *zerolog.Logger) func(*fasthttp.RequestCtx) {
 				return
 			}
 		}
+		succeeded = true
 	}
 }
 
-func (e *Endpoint) writeResponse(ctx Context, lo LogOption, res interface{}, zc *zerolog.Context) error {
+// writeResponse encodes res by codec c and writes it as response body with content type ct.
+// Response body of media type mt is logged as is if it's JSON, otherwise JSON view of res is logged.
+func (e *Endpoint) writeResponse(ctx Context, lo LogOption, res interface{}, c Codec, ct []byte, mt string, zc *zerolog.Context) error {
 
-	buf, err := json.Marshal(res)
+	buf, err := c.Marshal(res)
 	if err != nil {
 		*zc = zc.Interface("result", res)
 		return err
@@ -431,19 +709,28 @@ func (e *Endpoint) writeResponse(ctx Context, lo LogOption, res interface{}, zc
 		*zc = zc.Interface("result", res)
 	}
 
-	ctx.SetContentType(e.responseContentType)
+	ctx.SetContentType(ct)
 
 	if lo&LogRespBody != LogRespBody {
 		_, err = ctx.BodyWriter().Write(buf)
 		return err
 	}
 
+	logBuf := buf
+	if !isJSONMediaType(mt) {
+		*zc = zc.Str("respContentType", mt)
+		if logBuf, err = json.Marshal(res); err != nil {
+			logBuf = []byte(`{"marshalingError": ` + strconv.Quote(err.Error()) + `}`)
+		}
+	}
+
 	if e.jm == nil || len(e.resultFields) == 0 {
-		*zc = zc.RawJSON("respBody", buf)
-		return nil
+		*zc = zc.RawJSON("respBody", logBuf)
+		_, err = ctx.BodyWriter().Write(buf)
+		return err
 	}
 
-	maskedBuf, err := e.jm.Mask(buf, e.resultFields)
+	maskedBuf, err := e.jm.Mask(logBuf, e.resultFields)
 	if err != nil {
 		maskedBuf = []byte(`{"maskingError": "` + err.Error() + `"}`)
 	}
@@ -455,13 +742,14 @@ func (e *Endpoint) writeResponse(ctx Context, lo LogOption, res interface{}, zc
 }
 
 var (
-	ErrAuthorizationHeaderMissed = errors.New("header Authorization missed").Code("VTL-0001").StatusCode(401).Critical()
+	ErrAuthorizationHeaderMissed = errors.New("access token missed").Code("VTL-0001").StatusCode(401).Critical()
 	ErrAccessTokenRevoked        = errors.New("access token revoked").Code("VTL-0002").StatusCode(401).Critical()
+	ErrDeadlineExceeded          = errors.New("request processing deadline exceeded").Code("VTL-0006").StatusCode(504)
 )
 
-func (e *Endpoint) authorize(ctx *fasthttp.RequestCtx) (Tokener, error) {
+// authorize decodes access token at and checks endpoint's permissions.
+func (e *Endpoint) authorize(at []byte) (Tokener, error) {
 
-	at := ctx.Request.Header.Peek("Authorization")
 	if len(at) == 0 {
 		return nil, ErrAuthorizationHeaderMissed.Capture()
 	}
@@ -508,11 +796,15 @@ func (e *Endpoint) initController(ctx *fasthttp.RequestCtx, lo LogOption, zc zer
 		h   = e.Controller()
 	)
 
+	// all validation problems are collected and returned to the client at once.
+	var fe []FieldError
+
 	if e.isPathParametrized {
 		p := h.(Paramer).Param()
-		if zc, err = decodeParams(ctx, p, zc); err != nil {
+		if zc, err = decodeParams(ctx, p, e.pathParams, zc); err != nil {
 			return zc, nil, err
 		}
+		fe = append(fe, validateStruct(p, "param")...)
 	}
 
 	if e.isURLQueryExpected {
@@ -520,87 +812,173 @@ func (e *Endpoint) initController(ctx *fasthttp.RequestCtx, lo LogOption, zc zer
 		if zc, err = decodeURLQuery(ctx, in, zc); err != nil {
 			return zc, nil, err
 		}
+		fe = append(fe, validateStruct(in, "param")...)
+	}
+
+	if e.isMultipart {
+		in := h.(Inputer).Input()
+		if err := e.decodeMultipart(ctx, in); err != nil {
+			e.removeUploads(in, zc)
+			return zc, nil, err
+		}
+		if lo&LogReqInput == LogReqInput {
+			zc = zc.Interface("reqInput", in)
+		}
+		fe = append(fe, validateStruct(in, "form")...)
 	}
 
 	if e.isRequestBodyExpected {
-		if lo&LogReqBody == LogReqBody {
-			var (
-				cJSON *bytes.Buffer // compacted json
-				buf   []byte
-			)
-
-			cJSON = bytes.NewBuffer(nil)
-			buf = cJSON.Bytes()
-			key := "requestBody"
-			err := json.Compact(cJSON, ctx.Request.Body())
-			if err == nil && e.jm != nil && len(e.inputFields) > 0 {
-				if buf, err = e.jm.Mask(cJSON.Bytes(), e.inputFields); err == nil {
-					key = "maskedRequestBody"
-				}
-			}
-			if err != nil {
-				zc = zc.Str("maskingFailedMessage", err.Error())
-			}
-			zc = zc.RawJSON(key, buf)
+		c, mt, err := requestCodec(ctx)
+		if err != nil {
+			zc = zc.Str("reqContentType", mt)
+			return zc, nil, err
+		}
+
+		isJSON := isJSONMediaType(mt)
+		if lo&LogReqBody == LogReqBody && isJSON {
+			zc = e.logRequestBody(zc, ctx.Request.Body())
 		}
 
 		in := h.(Inputer).Input()
-		if err := decodeBody(ctx, in); err != nil {
+		if err := decodeBody(ctx, c, in); err != nil {
 			return zc, nil, err
 		}
+
+		// binary body is logged as JSON view of decoded input.
+		if lo&LogReqBody == LogReqBody && !isJSON {
+			zc = zc.Str("reqContentType", mt)
+			buf, err := json.Marshal(in)
+			if err != nil {
+				buf = []byte(`{"marshalingError": ` + strconv.Quote(err.Error()) + `}`)
+			}
+			zc = e.logRequestBody(zc, buf)
+		}
 		if lo&LogReqInput == LogReqInput {
 			zc = zc.Interface("reqInput", in)
 		}
+		fe = append(fe, validateStruct(in, "json")...)
+	}
+
+	if err := validationError(fe); err != nil {
+		if e.isMultipart {
+			e.removeUploads(h.(Inputer).Input(), zc)
+		}
+		return zc, nil, err
 	}
 
 	return zc, h, nil
 }
 
-// Doc возвращает описание входных и выходных параметров контроллера.
-func (e *Endpoint) handleDescription(ctx Context) error {
+// logRequestBody adds compacted JSON request body to the log context.
+// Attributes having tag "mask" are masked.
+func (e *Endpoint) logRequestBody(zc zerolog.Context, body []byte) zerolog.Context {
 
-	c := e.Controller()
+	cJSON := bytes.NewBuffer(nil) // compacted json
+	key := "requestBody"
 
-	ctx.SetContentType([]byte("text/html; charset=utf-8"))
-
-	_, err := ctx.BodyWriter().Write(e.genDescription(c))
+	err := json.Compact(cJSON, body)
+	buf := cJSON.Bytes()
+	if err == nil && e.jm != nil && len(e.inputFields) > 0 {
+		if buf, err = e.jm.Mask(cJSON.Bytes(), e.inputFields); err == nil {
+			key = "maskedRequestBody"
+		}
+	}
 	if err != nil {
-		return errors.Catch(err).StatusCode(500).Msg("description response write failed")
+		zc = zc.Str("maskingFailedMessage", err.Error())
+		buf = nil
 	}
-	return nil
+	return zc.RawJSON(key, buf)
 }
 
-func (e *Endpoint) genDescription(c Handler) []byte {
-	s := "Endpoint description: " + e.Method + " -  " + e.Path
-	if c == nil {
-		s += "No handler"
+// statusCodeOnSuccess returns status code of successful response of controller c.
+func (e *Endpoint) statusCodeOnSuccess(c Handler) int {
+	if e.SuccessStatusCode != 0 {
+		return e.SuccessStatusCode
 	}
-
-	if e.isPathParametrized {
-		//s += "\n" + goon.SDump(c.(Paramer).Param())
-		//s += "\n" + valast.String(c.(Paramer).Param()) + "\n"
+	_, isStream := c.(StreamResulter)
+	_, isFile := c.(FileResulter)
+	if _, ok := c.(Resulter); !ok && !isStream && !isFile {
+		return 204
 	}
+	if e.Method == "POST" {
+		return 201
+	}
+	return 200
+}
 
-	if e.isRequestBodyExpected {
-		//s += "Body input: \n" + valast.String(c.(Inputer).Input())
+// debugLogOption returns logging options required to debug request
+// data (if in is true) and response data (if out is true).
+func debugLogOption(in, out bool) LogOption {
+	lo := LogExit
+	if in {
+		lo |= LogReqBody | LogReqInput
+	}
+	if out {
+		lo |= LogRespBody | LogRespOutput
 	}
+	return lo
+}
 
-	if e.isURLQueryExpected {
-		//s += "URL input\n" + valast.String(c.(Inputer).Input())
+// allowedLogOption removes from lo logging of request and response data
+// if it's forbidden by NoInputLog and NoResultLog.
+func (e *Endpoint) allowedLogOption(lo LogOption) LogOption {
+	if e.NoInputLog {
+		lo &^= LogReqBody | LogReqInput
 	}
+	if e.NoResultLog {
+		lo &^= LogRespBody | LogRespOutput
+	}
+	return lo
+}
 
-	if e.hasRespBody {
-		//s += "\n" + valast.String(c.(Resulter).Result())
+// setSuccessStatusCode sets status code of successful response. Default status code
+// is not applied if controller has changed it or has written response body itself.
+func (e *Endpoint) setSuccessStatusCode(fctx *fasthttp.RequestCtx) {
+	if e.SuccessStatusCode == 0 {
+		if fctx.Response.StatusCode() != fasthttp.StatusOK {
+			return
+		}
+		if e.successStatusCode == fasthttp.StatusNoContent && len(fctx.Response.Body()) > 0 {
+			return
+		}
 	}
+	fctx.SetStatusCode(e.successStatusCode)
+}
 
-	return []byte(s)
+// handleDescription writes description of endpoint's input and output parameters.
+func (e *Endpoint) handleDescription(ctx Context) error {
+	if err := endpointDocumentation(e)(ctx); err != nil {
+		return errors.Catch(err).StatusCode(500).Msg("description response write failed")
+	}
+	return nil
 }
 
-// TODO: сделать поддержку param не в виде структуры, а в виде одной переменной.
-func decodeParams(ctx *fasthttp.RequestCtx, param interface{}, zcin zerolog.Context) (zerolog.Context, error) {
+// decodeParams populates param with values of URL path parameters.
+//
+// If param is a pointer to struct, fields are matched by tag "param", fields of
+// embedded and nested structs without tag "param" are populated as well.
+// Otherwise param is expected to be a pointer to a single value what
+// receives the only path parameter names[0].
+//
+// The same types as in URL query are supported (see decodeURLQuery).
+func decodeParams(ctx *fasthttp.RequestCtx, param interface{}, names []string, zc zerolog.Context) (zerolog.Context, error) {
 
-	zc := zcin
 	s := reflect.ValueOf(param).Elem()
+
+	if s.Kind() == reflect.Struct && !isDecodableType(s.Type()) {
+		return decodeParamStruct(ctx, s, zc)
+	}
+
+	if len(names) != 1 {
+		return zc, errors.ValidationFailed("single path parameter expected").SetStrs("params", names...)
+	}
+
+	return decodeParam(ctx, names[0], s, zc)
+}
+
+func decodeParamStruct(ctx *fasthttp.RequestCtx, s reflect.Value, zc zerolog.Context) (zerolog.Context, error) {
+
+	var err error
 	tof := s.Type()
 
 	for i := 0; i < tof.NumField(); i++ {
@@ -612,48 +990,46 @@ func decodeParams(ctx *fasthttp.RequestCtx, param interface{}, zcin zerolog.Cont
 
 		tag := tof.Field(i).Tag.Get("param")
 		if tag == "" {
+			if sf.Kind() == reflect.Ptr && sf.Type().Elem().Kind() == reflect.Struct && tof.Field(i).Anonymous {
+				if sf.IsNil() {
+					sf.Set(reflect.New(sf.Type().Elem()))
+				}
+				sf = sf.Elem()
+			}
+			if sf.Kind() == reflect.Struct && !isDecodableType(sf.Type()) {
+				if zc, err = decodeParamStruct(ctx, sf, zc); err != nil {
+					return zc, err
+				}
+			}
 			continue
 		}
 
-		val, ok := ctx.UserValue(tag).(string)
-		if !ok {
-			panic("non string param")
+		if zc, err = decodeParam(ctx, tag, sf, zc); err != nil {
+			return zc, err
 		}
+	}
+	return zc, nil
+}
 
-		zc = zc.Interface(tag, val)
+// decodeParam assigns value of path parameter name to v.
+func decodeParam(ctx *fasthttp.RequestCtx, name string, v reflect.Value, zc zerolog.Context) (zerolog.Context, error) {
+
+	var val string
+	switch x := ctx.UserValue(name).(type) {
+	case string:
+		val = x
+	case []byte:
+		val = string(x)
+	case nil:
+		return zc, nil
+	default:
+		return zc, errors.ValidationFailed("path parameter has unexpected type").Set("param", name).Set("type", fmt.Sprintf("%T", x))
+	}
 
-		switch sf.Interface().(type) {
-		case int, int8, int16, int32, int64:
-			i, err := strconv.ParseInt(val, 10, 64)
-			if err != nil {
-				return zc, errors.ValidationFailed(err.Error())
-			}
-			sf.SetInt(i)
-		case uint, uint8, uint16, uint32, uint64:
-			i, err := strconv.ParseUint(val, 10, 64)
-			if err != nil {
-				return zc, errors.ValidationFailed(err.Error())
-			}
-			sf.SetUint(i)
-		case string:
-			sf.SetString(val)
-		case bool:
-			b, err := strconv.ParseBool(val)
-			if err != nil {
-				return zc, errors.ValidationFailed(err.Error())
-			}
-			sf.SetBool(b)
-		case float32, float64:
-			f, err := strconv.ParseFloat(val, 64)
-			if err != nil {
-				return zc, errors.ValidationFailed(err.Error())
-			}
-			sf.SetFloat(f)
-		case []string:
-			break
-		default:
-			return zc, errors.ValidationFailed("unsuppoted go type").Set("tag", tag)
-		}
+	zc = zc.Str(name, val)
+
+	if err := decodeField(v, []string{val}); err != nil {
+		return zc, invalidParamError(err, name, []string{val})
 	}
 	return zc, nil
 }
@@ -662,17 +1038,27 @@ func assign(val string, i interface{}) error {
 	return nil
 }
 
-func decodeBody(ctx *fasthttp.RequestCtx, dest interface{}) error {
+// decodeBody decodes request body by codec c to dest.
+func decodeBody(ctx *fasthttp.RequestCtx, c Codec, dest interface{}) error {
 	buf := ctx.Request.Body()
 	if len(buf) == 0 {
-		return errors.InvalidRequestBody("empty request body. JSON expected")
+		return errors.InvalidRequestBody("empty request body")
 	}
-	return json.Unmarshal(buf, dest)
+	return c.Unmarshal(buf, dest)
 }
 
+// decodeURLQuery populates struct input with URL query values. Fields are matched
+// by tag "param". Fields of nested structs without tag "param" are populated as well.
+//
+// Supported field types: scalar kinds, time.Time, time.Duration, date.Date, uuid.UUID,
+// types implementing Dater or encoding.TextUnmarshaler, types registered by RegisterDecoder,
+// slices of them (?id=1&id=2 or ?id=1,2) and maps with string keys (?filter[name]=John).
 func decodeURLQuery(ctx *fasthttp.RequestCtx, input interface{}, zc zerolog.Context) (zerolog.Context, error) {
+	return decodeQueryStruct(ctx.QueryArgs(), reflect.ValueOf(input).Elem(), zc)
+}
+
+func decodeQueryStruct(args *fasthttp.Args, s reflect.Value, zc zerolog.Context) (zerolog.Context, error) {
 
-	s := reflect.ValueOf(input).Elem()
 	tof := s.Type()
 
 	for i := 0; i < tof.NumField(); i++ {
@@ -683,112 +1069,142 @@ func decodeURLQuery(ctx *fasthttp.RequestCtx, input interface{}, zc zerolog.Cont
 			continue
 		}
 
-		if sf.Kind() == reflect.Struct {
-			if zc, err := decodeURLQuery(ctx, sf.Addr().Interface(), zc); err != nil {
-				return zc, err
+		tag := atof.Tag.Get("param")
+		if tag == "" {
+			if sf.Kind() == reflect.Struct && !isDecodableType(sf.Type()) {
+				var err error
+				if zc, err = decodeQueryStruct(args, sf, zc); err != nil {
+					return zc, err
+				}
 			}
 			continue
 		}
 
-		tag := atof.Tag.Get("param")
-		if tag == "" {
+		if sf.Kind() == reflect.Map && !isDecodableType(sf.Type()) {
+			if err := decodeQueryMap(args, tag, sf); err != nil {
+				return zc, err
+			}
+			if sf.Len() > 0 {
+				zc = zc.Interface(tag, sf.Interface())
+			}
 			continue
 		}
 
-		val := ctx.QueryArgs().Peek(tag)
-		zc = zc.Bytes(tag, val)
-		if val == nil {
+		mv := args.PeekMulti(tag)
+		if len(mv) == 0 {
+			zc = zc.Bytes(tag, nil)
 			continue
 		}
 
-		if sf.Kind() == reflect.Ptr {
-			if sf.IsNil() {
-				sf.Set(reflect.New(sf.Type().Elem()))
-			}
-			sf = sf.Elem()
+		vals := make([]string, len(mv))
+		for j := range mv {
+			vals[j] = string(mv[j])
 		}
 
-		if atof.Type.Name() == "Date" {
-			if _, ok := sf.Interface().(date.Date); ok {
-				d, err := date.Parse(string(val))
-				if err != nil {
-					return zc, err
-				}
-				sf.SetUint(uint64(d))
-			}
-			continue
+		if len(vals) == 1 {
+			zc = zc.Str(tag, vals[0])
+		} else {
+			zc = zc.Strs(tag, vals)
 		}
 
-		switch sf.Kind() {
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			k, err := strconv.ParseInt(string(val), 10, 64)
-			if err != nil {
-				return zc, err
-			}
-			sf.SetInt(k)
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			k, err := strconv.ParseUint(string(val), 10, 64)
-			if err != nil {
-				return zc, err
-			}
-			sf.SetUint(k)
-		case reflect.String:
-			sf.SetString(string(val))
-		case reflect.Float64:
-			k, err := strconv.ParseFloat(string(val), 64)
-			if err != nil {
-				return zc, err
-			}
-			sf.SetFloat(k)
-		case reflect.Float32:
-			k, err := strconv.ParseFloat(string(val), 32)
-			if err != nil {
-				return zc, err
-			}
-			sf.SetFloat(k)
-		case reflect.Bool:
-			b, err := strconv.ParseBool(string(val))
-			if err != nil {
-				return zc, err
-			}
-			sf.SetBool(b)
-		default:
-			return zc, errors.ValidationFailed("unsupported type").Set("val", string(val)).Set("kind", sf.Kind().String())
+		if err := decodeField(sf, vals); err != nil {
+			return zc, invalidParamError(err, tag, vals)
 		}
 	}
 	return zc, nil
 }
 
+// decodeQueryMap populates map m from URL query values having keys like tag[key].
+func decodeQueryMap(args *fasthttp.Args, tag string, m reflect.Value) error {
+
+	if m.Type().Key().Kind() != reflect.String {
+		return errors.ValidationFailed("unsupported map key type").Set("param", tag)
+	}
+
+	var err error
+	args.VisitAll(func(key, val []byte) {
+		if err != nil || len(key) < len(tag)+3 || string(key[:len(tag)+1]) != tag+"[" || key[len(key)-1] != ']' {
+			return
+		}
+
+		if m.IsNil() {
+			m.Set(reflect.MakeMap(m.Type()))
+		}
+
+		k := string(key[len(tag)+1 : len(key)-1])
+		ev := reflect.New(m.Type().Elem()).Elem()
+		if err = decodeField(ev, []string{string(val)}); err != nil {
+			err = invalidParamError(err, string(key), []string{string(val)})
+			return
+		}
+		m.SetMapIndex(reflect.ValueOf(k).Convert(m.Type().Key()), ev)
+	})
+	return err
+}
+
+// invalidParamError wraps error of converting URL parameter value.
+func invalidParamError(err error, param string, vals []string) error {
+	return errors.Catch(err).StatusCode(400).Set("param", param).SetStrs("val", vals...).Msg("invalid value of parameter " + param)
+}
+
 func (e *Endpoint) compile(v *Vatel) error {
 	opath := e.Path
+	if e.check != nil {
+		if err := e.check(v); err != nil {
+			return fmt.Errorf("endpoint %s %s: %s", e.Method, opath, err)
+		}
+	}
 	e.Path = path.Join(v.cfg.urlPrefix, e.Path)
 	e.auth = v.auth
 	e.td = v.td
 	e.pm = v.pm
 	e.rd = v.rd
 	e.rtc = v.rtc
-	e.middlewares = v.mdw
+	if e.TokenExtractor == nil {
+		e.TokenExtractor = v.te
+	}
+	if e.TokenExtractor == nil {
+		e.TokenExtractor = defaultTokenExtractor
+	}
+	// middlewares are called in order: global, group's, endpoint's.
+	var gmdw middlewareSet
+	if e.group != nil {
+		gmdw = e.group.middlewares()
+	}
+	for pos := range e.Middlewares {
+		if pos < BeforeAuthorization || pos > OnErrorResponse {
+			return fmt.Errorf("endpoint %s %s has middleware at unknown position %d", e.Method, opath, pos)
+		}
+	}
+	for i := range e.middlewares {
+		e.middlewares[i] = append(append(append([]func(Context) error{}, v.mdw[i]...), gmdw[i]...), e.Middlewares[MiddlewarePos(i)]...)
+	}
 	e.staticLoggingLevel = v.cfg.staticLoggingLevel
 	e.verboseError = v.cfg.verboseError
 	e.logRequestID = v.cfg.logRequestID
 	e.jm = v.cfg.jm
 	e.ala = v.cfg.ala
 	e.mr = v.cfg.mr
+	e.ifr, _ = v.cfg.mr.(InFlightReporter)
 
 	if e.LogOptions == LogUnknown {
 		e.LogOptions = v.cfg.defaultLogOption
 	}
 
-	if e.LogOptions&LogSilent == e.LogOptions {
-		e.LogOptions = e.LogOptions
-	}
-
 	if e.ResponseContentType != "" {
 		e.responseContentType = []byte(e.ResponseContentType)
 	} else {
 		e.responseContentType = []byte("application/json; charset=utf-8")
 	}
 
+	// default codec is used if ResponseContentType has no registered codec.
+	e.respMediaType = mediaType(e.responseContentType)
+	if c, ok := lookupCodec(e.respMediaType); ok {
+		e.respCodec = c
+	} else {
+		e.respCodec = codec.JSON{}
+	}
+
 	if len(e.Perms) > 0 {
 		if e.auth == nil && !v.authDisabled {
 			return fmt.Errorf("endpoint %s %s requires calling SetAuthorizer() before", e.Method, opath)
@@ -801,14 +1217,63 @@ func (e *Endpoint) compile(v *Vatel) error {
 			return fmt.Errorf("endpoint %s %s requires calling SetPermissionManager() before", e.Method, opath)
 		}
 
-		for i := range e.Perms {
-			pb, ok := v.pm.PermissionBitPos(e.Perms[i])
+		for i := 0; e.pm != nil && i < len(e.Perms); i++ {
+			pb, ok := e.pm.PermissionBitPos(e.Perms[i])
 			if !ok {
 				return fmt.Errorf("endpoint %s %s mentioned unknown permission %s", e.Method, opath, e.Perms[i])
 			}
 			e.perms = append(e.perms, pb)
 		}
 	}
+	if e.RateLimit != nil {
+		if e.RateLimit.Requests <= 0 || e.RateLimit.Window <= 0 {
+			return fmt.Errorf("endpoint %s %s has invalid RateLimit: Requests and Window must be positive", e.Method, opath)
+		}
+		if v.rls == nil {
+			v.rls = NewMemoryRateLimitStore()
+		}
+		e.rls = v.rls
+	}
+
+	e.baseCtx = v.cfg.baseCtx
+	if e.baseCtx == nil {
+		e.baseCtx = context.Background()
+	}
+
+	e.cors = v.cfg.cors
+	if e.CORS != nil {
+		e.cors = e.CORS
+	}
+	if e.cors != nil {
+		if err := e.cors.validate(); err != nil {
+			return fmt.Errorf("endpoint %s %s: %s", e.Method, opath, err)
+		}
+	}
+
+	if e.Cache != nil {
+		if e.Method != "GET" {
+			return fmt.Errorf("endpoint %s %s cannot have CachePolicy, only GET is supported", e.Method, opath)
+		}
+		if e.Cache.ServerTTL > 0 {
+			if v.rc == nil {
+				v.rc = NewMemoryResponseCache()
+			}
+			e.rc = v.rc
+		}
+	}
+
+	if e.Idempotent {
+		switch e.Method {
+		case "POST", "PUT", "PATCH":
+		default:
+			return fmt.Errorf("endpoint %s %s cannot be idempotent, only POST, PUT and PATCH are supported", e.Method, opath)
+		}
+		if v.ids == nil {
+			v.ids = NewMemoryIdempotencyStore()
+		}
+		e.ids = v.ids
+	}
+
 	c := e.Controller()
 
 	// looking for "{ }"" in the path
@@ -828,6 +1293,17 @@ func (e *Endpoint) compile(v *Vatel) error {
 		return fmt.Errorf("endpoint %s %s path has no parameters, but controller implement Paramer", e.Method, opath)
 	}
 	e.isPathParametrized = isParamer
+	e.pathParams = pathParams(e.Path)
+
+	if isParamer {
+		pt := reflect.TypeOf(c.(Paramer).Param())
+		if pt == nil || pt.Kind() != reflect.Ptr {
+			return fmt.Errorf("endpoint %s %s Param() must return a pointer", e.Method, opath)
+		}
+		if et := pt.Elem(); (et.Kind() != reflect.Struct || isDecodableType(et)) && len(e.pathParams) != 1 {
+			return fmt.Errorf("endpoint %s %s Param() returns a single value, but path has %d parameters", e.Method, opath, len(e.pathParams))
+		}
+	}
 
 	ri, hasRespBody := c.(Resulter)
 	if hasRespBody && e.jm != nil {
@@ -835,18 +1311,74 @@ func (e *Endpoint) compile(v *Vatel) error {
 	}
 	e.hasRespBody = hasRespBody
 
+	_, e.isEventStream = c.(EventStreamer)
+	if e.isEventStream && (e.Method != "GET" || hasRespBody || e.Cache != nil) {
+		return fmt.Errorf("endpoint %s %s streaming events must be GET without Resulter and CachePolicy", e.Method, opath)
+	}
+
+	mh, isWebSocket := c.(MessageHandler)
+	if isWebSocket {
+		if e.Method != "GET" || hasRespBody || e.isEventStream || e.Cache != nil {
+			return fmt.Errorf("endpoint %s %s accepting websocket must be GET without Resulter, EventStreamer and CachePolicy", e.Method, opath)
+		}
+		if mt := reflect.TypeOf(mh.Message()); mt == nil || mt.Kind() != reflect.Ptr {
+			return fmt.Errorf("endpoint %s %s Message() must return a pointer", e.Method, opath)
+		}
+		e.ws = &v.ws
+	}
+	e.isWebSocket = isWebSocket
+
+	_, e.isFile = c.(FileResulter)
+	if e.isFile && (hasRespBody || e.isEventStream || e.isWebSocket || e.Cache != nil) {
+		return fmt.Errorf("endpoint %s %s sending file cannot implement Resulter, EventStreamer, MessageHandler or have CachePolicy", e.Method, opath)
+	}
+
+	_, e.isResultStream = c.(StreamResulter)
+	if e.isResultStream && (hasRespBody || e.isEventStream || e.isWebSocket || e.isFile || e.Cache != nil || e.Idempotent) {
+		return fmt.Errorf("endpoint %s %s streaming result cannot implement Resulter, EventStreamer, MessageHandler or have CachePolicy, Idempotent", e.Method, opath)
+	}
+	e.successStatusCode = e.statusCodeOnSuccess(c)
+
 	ii, isInputer := c.(Inputer)
 	if isInputer && e.jm != nil {
 		e.inputFields = e.jm.Fields(ii.Input(), "mask")
 	}
 
+	if isInputer {
+		if err := checkValidationTags(reflect.TypeOf(ii.Input())); err != nil {
+			return fmt.Errorf("endpoint %s %s input: %s", e.Method, opath, err.Error())
+		}
+	}
+
+	if isParamer {
+		if err := checkValidationTags(reflect.TypeOf(c.(Paramer).Param())); err != nil {
+			return fmt.Errorf("endpoint %s %s param: %s", e.Method, opath, err.Error())
+		}
+	}
+
 	switch e.Method {
 	case "GET", "DELETE":
 		e.isURLQueryExpected = isInputer
 	case "POST", "PUT", "PATCH":
-		e.isRequestBodyExpected = isInputer
+		e.isMultipart = isInputer && hasFormTags(reflect.TypeOf(ii.Input()))
+		e.isRequestBodyExpected = isInputer && !e.isMultipart
 	default:
 		return fmt.Errorf("endpoint %s has unknown HTTP method %s", opath, e.Method)
 	}
+
+	if e.Upload != nil && !e.isMultipart {
+		return fmt.Errorf("endpoint %s %s has UploadPolicy, but input has no fields with tag form", e.Method, opath)
+	}
+	if e.isMultipart {
+		if e.Upload != nil {
+			e.upload = *e.Upload
+		}
+		if e.upload.MaxFileSize <= 0 {
+			e.upload.MaxFileSize = DefaultMaxUploadSize
+		}
+		if e.upload.Storage == nil {
+			e.upload.Storage = TempDirStorage{}
+		}
+	}
 	return nil
 }
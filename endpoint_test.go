@@ -1,9 +1,20 @@
 package vatel
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/axkit/date"
+	"github.com/axkit/errors"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
 	"github.com/valyala/fasthttp"
 )
 
@@ -28,7 +39,7 @@ func TestDecodeURLQuery(t *testing.T) {
 	ctx.QueryArgs().Add("day", "2021-09-01")
 	ctx.QueryArgs().Add("g", "0.5")
 
-	if err := decodeURLQuery(&ctx, &a); err != nil {
+	if _, err := decodeURLQuery(&ctx, &a, zerolog.Nop().With()); err != nil {
 		t.Error(err)
 	}
 
@@ -37,3 +48,367 @@ func TestDecodeURLQuery(t *testing.T) {
 	}
 
 }
+
+func TestEndpoint_description(t *testing.T) {
+	e := Endpoint{Method: "GET", Path: "/customers/{id}", Perms: []string{"CustomerView"}, Controller: func() Handler { return &testCustomerController{} }}
+
+	d := e.description()
+	if len(d.PathParams) != 1 || d.PathParams[0].Type != "integer (int64)" {
+		t.Fatalf("unexpected path params: %+v", d.PathParams)
+	}
+
+	names := ""
+	for _, f := range d.ResultFields {
+		names += f.Name + ":" + f.Mask + " "
+	}
+	if names != "id: name: email:email Tags: " {
+		t.Errorf("unexpected result fields: %s", names)
+	}
+
+	if !strings.Contains(string(d.ResultExample), `"email": "string"`) {
+		t.Errorf("unexpected result example: %s", d.ResultExample)
+	}
+
+	var buf bytes.Buffer
+	if err := descriptionTemplate.Execute(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<code>CustomerView</code>") {
+		t.Errorf("permissions expected in HTML: %s", buf.String())
+	}
+}
+
+type testNilInputController struct{}
+
+func (c *testNilInputController) Input() interface{}   { return nil }
+func (c *testNilInputController) Handle(Context) error { return nil }
+
+func TestEndpoint_descriptionBody(t *testing.T) {
+
+	e := Endpoint{Method: "POST", Path: "/uploads", Controller: func() Handler { return &testUploadController{} }}
+	d := e.description()
+	if d.RequestContentType != "multipart/form-data" || len(d.BodyExample) != 0 {
+		t.Errorf("multipart body expected, got %s %s", d.RequestContentType, d.BodyExample)
+	}
+	names := ""
+	for _, f := range d.BodyFields {
+		names += f.Name + ":" + f.Type + " "
+	}
+	if names != "title:string count:integer (int64) photo:string (binary) docs:[]string (binary) " {
+		t.Errorf("unexpected body fields: %s", names)
+	}
+
+	e = Endpoint{Method: "POST", Path: "/nil", Controller: func() Handler { return &testNilInputController{} }}
+	if d := e.description(); d.Body != nil || d.BodyExample != nil {
+		t.Errorf("empty body expected, got %+v", d)
+	}
+}
+
+type testMoney int64
+
+// registerTestDecoder registers decoder like RegisterDecoder and returns function
+// restoring the previous state of the global registry.
+func registerTestDecoder(sample interface{}, f ValueDecoder) (restore func()) {
+	t := reflect.TypeOf(sample)
+
+	decodersMu.Lock()
+	prev, ok := decoders[t]
+	decoders[t] = f
+	decodersMu.Unlock()
+
+	return func() {
+		decodersMu.Lock()
+		if ok {
+			decoders[t] = prev
+		} else {
+			delete(decoders, t)
+		}
+		decodersMu.Unlock()
+	}
+}
+
+func TestDecodeURLQuery_Types(t *testing.T) {
+
+	defer registerTestDecoder(testMoney(0), func(s string) (interface{}, error) {
+		f, err := strconv.ParseFloat(s, 64)
+		return testMoney(f * 100), err
+	})()
+
+	ctx := fasthttp.RequestCtx{}
+	ctx.QueryArgs().Add("id", "1")
+	ctx.QueryArgs().Add("id", "2,3")
+	ctx.QueryArgs().Add("names", "a,b")
+	ctx.QueryArgs().Add("from", "2021-09-01T10:00:00Z")
+	ctx.QueryArgs().Add("timeout", "1m30s")
+	ctx.QueryArgs().Add("uid", "7d444840-9dc0-11d1-b245-5ffdce74fad2")
+	ctx.QueryArgs().Add("ip", "10.0.0.1")
+	ctx.QueryArgs().Add("filter[name]", "John")
+	ctx.QueryArgs().Add("filter[city]", "Riga")
+	ctx.QueryArgs().Add("amount", "1.5")
+	ctx.QueryArgs().Add("limit", "10")
+
+	a := struct {
+		IDs     []int             `param:"id"`
+		Names   []string          `param:"names"`
+		From    time.Time         `param:"from"`
+		Timeout time.Duration     `param:"timeout"`
+		UID     uuid.UUID         `param:"uid"`
+		IP      net.IP            `param:"ip"`
+		Filter  map[string]string `param:"filter"`
+		Amount  testMoney         `param:"amount"`
+		Limit   *int              `param:"limit"`
+		Offset  *int              `param:"offset"`
+	}{}
+
+	if _, err := decodeURLQuery(&ctx, &a, zerolog.Nop().With()); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(a.IDs) != "[1 2 3]" || fmt.Sprint(a.Names) != "[a b]" {
+		t.Errorf("unexpected slices: %v %v", a.IDs, a.Names)
+	}
+	if a.From.Day() != 1 || a.Timeout != 90*time.Second || a.UID.String() != "7d444840-9dc0-11d1-b245-5ffdce74fad2" {
+		t.Errorf("unexpected time/uuid values: %v %v %v", a.From, a.Timeout, a.UID)
+	}
+	if a.IP.String() != "10.0.0.1" || a.Filter["name"] != "John" || a.Filter["city"] != "Riga" || a.Amount != 150 {
+		t.Errorf("unexpected values: %v %v %v", a.IP, a.Filter, a.Amount)
+	}
+	if a.Limit == nil || *a.Limit != 10 || a.Offset != nil {
+		t.Errorf("unexpected pointers: %v %v", a.Limit, a.Offset)
+	}
+
+	ctx.QueryArgs().Set("id", "x")
+	if _, err := decodeURLQuery(&ctx, &a, zerolog.Nop().With()); err == nil {
+		t.Error("error expected")
+	}
+}
+
+type testCurrency string
+
+func TestDecodeValue_decoderType(t *testing.T) {
+
+	defer registerTestDecoder(testCurrency(""), func(s string) (interface{}, error) {
+		if s == "" {
+			return nil, nil
+		}
+		return s, nil
+	})()
+
+	var c testCurrency
+	for _, s := range []string{"EUR", ""} {
+		if err := decodeValue(reflect.ValueOf(&c).Elem(), s); err == nil {
+			t.Errorf("%q: error expected for value of unexpected type", s)
+		}
+	}
+}
+
+func TestDecodeParams(t *testing.T) {
+
+	type Base struct {
+		ID int `param:"id"`
+	}
+
+	p := struct {
+		Base
+		UID  uuid.UUID `param:"uid"`
+		Day  date.Date `param:"day"`
+		Tags []string  `param:"tags"`
+	}{}
+
+	ctx := fasthttp.RequestCtx{}
+	ctx.SetUserValue("id", "10")
+	ctx.SetUserValue("uid", []byte("7d444840-9dc0-11d1-b245-5ffdce74fad2"))
+	ctx.SetUserValue("day", "2021-09-01")
+	ctx.SetUserValue("tags", "a,b")
+
+	if _, err := decodeParams(&ctx, &p, nil, zerolog.Nop().With()); err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != 10 || p.UID.String() != "7d444840-9dc0-11d1-b245-5ffdce74fad2" || p.Day != 0x20210901 || len(p.Tags) != 2 {
+		t.Errorf("unexpected result: %+v", p)
+	}
+
+	var id int64
+	if _, err := decodeParams(&ctx, &id, []string{"id"}, zerolog.Nop().With()); err != nil || id != 10 {
+		t.Errorf("single param expected 10, got %d, %v", id, err)
+	}
+
+	ctx.SetUserValue("id", 1.5)
+	if _, err := decodeParams(&ctx, &id, []string{"id"}, zerolog.Nop().With()); err == nil {
+		t.Error("error expected for non string user value")
+	}
+
+	ctx.SetUserValue("id", "abc")
+	if _, err := decodeParams(&ctx, &p, nil, zerolog.Nop().With()); err == nil {
+		t.Error("error expected for invalid int")
+	}
+}
+
+type testFailingController struct{}
+
+func (c *testFailingController) Handle(Context) error {
+	return errors.NotFound("customer not found").Code("CUS-0001")
+}
+
+func TestEndpoint_OnErrorResponse(t *testing.T) {
+
+	var calls []string
+
+	v := NewVatel()
+	v.AddMiddleware(OnErrorResponse, func(ctx Context) error {
+		calls = append(calls, "global")
+		if ctx.ResponseError() == nil {
+			t.Error("error expected")
+		}
+		return nil
+	})
+	v.AddMiddleware(OnErrorResponse, ProblemResponse(nil))
+
+	e := NewEndpoint("GET", "/customers", nil, func() Handler { return &testFailingController{} })
+	e.AddMiddleware(OnErrorResponse, func(ctx Context) error {
+		calls = append(calls, "endpoint")
+		ctx.SetHeader([]byte("X-Error"), []byte("1"))
+		return nil
+	})
+	if err := e.compile(v); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	var fctx fasthttp.RequestCtx
+	fctx.Request.SetRequestURI("/customers")
+	e.handler(&l)(&fctx)
+
+	if strings.Join(calls, ",") != "global,endpoint" {
+		t.Errorf("unexpected middleware calls: %v", calls)
+	}
+
+	if fctx.Response.StatusCode() != 404 || string(fctx.Response.Header.ContentType()) != "application/problem+json" {
+		t.Errorf("unexpected response: %d %s", fctx.Response.StatusCode(), fctx.Response.Header.ContentType())
+	}
+
+	if string(fctx.Response.Header.Peek("X-Error")) != "1" {
+		t.Error("header X-Error expected")
+	}
+
+	expected := `{"code":"CUS-0001","instance":"/customers","status":404,"title":"customer not found"}`
+	if body := string(fctx.Response.Body()); body != expected {
+		t.Errorf("expected %s, got %s", expected, body)
+	}
+}
+
+type testSlowController struct{}
+
+func (c *testSlowController) Handle(ctx Context) error {
+	if ctx.Context().Value("tenant") != "acme" {
+		return errors.ValidationFailed("user value expected in context")
+	}
+	<-ctx.Context().Done()
+	return ctx.Context().Err()
+}
+
+func TestEndpoint_Timeout(t *testing.T) {
+
+	e := NewEndpoint("GET", "/slow", nil, func() Handler { return &testSlowController{} })
+	e.Timeout = 10 * time.Millisecond
+	if err := e.compile(NewVatel()); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	var fctx fasthttp.RequestCtx
+	fctx.SetUserValue("tenant", "acme")
+	e.handler(&l)(&fctx)
+
+	if fctx.Response.StatusCode() != 504 || !strings.Contains(string(fctx.Response.Body()), "VTL-0006") {
+		t.Errorf("unexpected response: %d %s", fctx.Response.StatusCode(), fctx.Response.Body())
+	}
+}
+
+func TestEndpoint_baseContext(t *testing.T) {
+
+	base, cancel := context.WithCancel(context.Background())
+	e := NewEndpoint("GET", "/slow", nil, func() Handler { return &testSlowController{} })
+	if err := e.compile(NewVatel(WithBaseContext(base))); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	var fctx fasthttp.RequestCtx
+	fctx.SetUserValue("tenant", "acme")
+
+	done := make(chan struct{})
+	go func() {
+		e.handler(&l)(&fctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("request context must be cancelled with base context")
+	}
+	if fctx.Response.StatusCode() == 200 || fctx.Response.StatusCode() == 504 {
+		t.Errorf("unexpected status %d", fctx.Response.StatusCode())
+	}
+}
+
+type testStatusController struct {
+	code int
+	res  struct{ ID int }
+}
+
+func (c *testStatusController) Handle(ctx Context) error {
+	if c.code != 0 {
+		ctx.SetStatusCode(c.code)
+	}
+	return nil
+}
+
+type testResultStatusController struct{ testStatusController }
+
+func (c *testResultStatusController) Result() interface{} { return &c.res }
+
+type testMetricReporter struct{ statusCode int }
+
+func (mr *testMetricReporter) ReportMetric(method, path string, statusCode int, dur float64, size int) {
+	mr.statusCode = statusCode
+}
+
+func TestEndpoint_successStatusCode(t *testing.T) {
+
+	cases := []struct {
+		e        Endpoint
+		c        Handler
+		expected int
+	}{
+		{Endpoint{Method: "POST"}, &testResultStatusController{}, 201},
+		{Endpoint{Method: "PUT"}, &testResultStatusController{}, 200},
+		{Endpoint{Method: "DELETE"}, &testStatusController{}, 204},
+		{Endpoint{Method: "POST", SuccessStatusCode: 202}, &testStatusController{}, 202},
+		{Endpoint{Method: "GET", ManualStatusCode: true}, &testResultStatusController{testStatusController{code: 206}}, 206},
+		{Endpoint{Method: "POST"}, &testResultStatusController{testStatusController{code: 202}}, 202},
+		{Endpoint{Method: "GET"}, &tocController{s: NewVatel()}, 200},
+	}
+
+	for i := range cases {
+		mr := testMetricReporter{}
+		e := cases[i].e
+		c := cases[i].c
+		e.Path = "/status"
+		e.Controller = func() Handler { return c }
+		if err := e.compile(NewVatel(WithMetricReporter(&mr))); err != nil {
+			t.Fatal(err)
+		}
+
+		l := zerolog.Nop()
+		var fctx fasthttp.RequestCtx
+		fctx.Request.SetBody([]byte("{}"))
+		e.handler(&l)(&fctx)
+
+		if sc := fctx.Response.StatusCode(); sc != cases[i].expected || mr.statusCode != sc {
+			t.Errorf("case %d: expected %d, got %d, reported %d", i, cases[i].expected, sc, mr.statusCode)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package vatel
+
+import (
+	"io"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axkit/errors"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+var ErrRangeNotSatisfiable = errors.New("requested range not satisfiable").Code("VTL-0014").StatusCode(416)
+
+// FileResulter is the interface what wraps a single method File.
+//
+// If endpoint's controller implements FileResulter, the file returned by File
+// is streamed as response body after Handle. Requests with headers Range,
+// If-Range, If-None-Match and If-Modified-Since are supported.
+type FileResulter interface {
+	File() *File
+}
+
+// File describes the file sent to the client.
+type File struct {
+	// Content is the file content. Ranges are supported if Content implements
+	// io.Seeker and Size is known. Content is closed after sending if it
+	// implements io.Closer.
+	Content io.Reader
+
+	// Name is the file name sent in header Content-Disposition.
+	Name string
+
+	// Size is the content size in bytes, -1 if unknown.
+	Size int64
+
+	// ModTime is the last modification time. Used for conditional requests.
+	ModTime time.Time
+
+	// ContentType is the file media type. If empty, it's detected by extension
+	// of Name, application/octet-stream is used otherwise.
+	ContentType string
+
+	// Inline turns Content-Disposition to "inline", the default is "attachment".
+	Inline bool
+}
+
+// etag returns entity tag built from modification time and size.
+// Returns empty string if any of them is unknown.
+func (f *File) etag() string {
+	if f.ModTime.IsZero() || f.Size < 0 {
+		return ""
+	}
+	return `"` + strconv.FormatInt(f.ModTime.UnixNano(), 16) + "-" + strconv.FormatInt(f.Size, 16) + `"`
+}
+
+// contentDisposition returns value of header Content-Disposition. Non ASCII
+// names are sent as filename* (RFC 6266) with ASCII fallback.
+func contentDisposition(inline bool, name string) string {
+	res := "attachment"
+	if inline {
+		res = "inline"
+	}
+	if name == "" {
+		return res
+	}
+
+	ascii := true
+	fallback := make([]byte, 0, len(name))
+	for _, c := range name {
+		if c < 0x20 || c > 0x7e || c == '"' || c == '\\' {
+			fallback = append(fallback, '_')
+			ascii = ascii && c < 0x80
+			continue
+		}
+		fallback = append(fallback, byte(c))
+	}
+
+	res += `; filename="` + string(fallback) + `"`
+	if !ascii {
+		res += "; filename*=UTF-8''" + extValueEscape(name)
+	}
+	return res
+}
+
+// extValueEscape percent-encodes s as value of extended parameter (RFC 5987, 3.2.1).
+// Symbols "$", "&", "+" are attr-char too, but they are encoded because
+// some clients decode the value like URL query.
+func extValueEscape(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var res strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#-.^_`|~", c) >= 0 {
+			res.WriteByte(c)
+			continue
+		}
+		res.WriteByte('%')
+		res.WriteByte(hex[c>>4])
+		res.WriteByte(hex[c&0x0f])
+	}
+	return res.String()
+}
+
+// parseRange parses header Range value having a single byte range. Returns ok false
+// if header must be ignored (syntax error, multiple ranges) and ErrRangeNotSatisfiable
+// if range is out of size.
+func parseRange(s string, size int64) (start, length int64, ok bool, err error) {
+
+	if !strings.HasPrefix(s, "bytes=") || strings.Contains(s, ",") {
+		return 0, 0, false, nil
+	}
+
+	s = strings.TrimSpace(s[len("bytes="):])
+	idx := strings.IndexByte(s, '-')
+	if idx < 0 {
+		return 0, 0, false, nil
+	}
+	from, to := strings.TrimSpace(s[:idx]), strings.TrimSpace(s[idx+1:])
+
+	if from == "" {
+		// suffix range: the last n bytes.
+		n, perr := strconv.ParseInt(to, 10, 64)
+		if perr != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, ErrRangeNotSatisfiable.Capture()
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+
+	start, perr := strconv.ParseInt(from, 10, 64)
+	if perr != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	if start >= size {
+		return 0, 0, false, ErrRangeNotSatisfiable.Capture()
+	}
+
+	end := size - 1
+	if to != "" {
+		if end, perr = strconv.ParseInt(to, 10, 64); perr != nil || end < start {
+			return 0, 0, false, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true, nil
+}
+
+// isRangeApplicable returns true if header If-Range is absent or matches the file.
+func isRangeApplicable(fctx *fasthttp.RequestCtx, etag string, modTime time.Time) bool {
+	ir := fctx.Request.Header.Peek("If-Range")
+	if len(ir) == 0 {
+		return true
+	}
+	// If-Range requires strong comparison.
+	if ir[0] == '"' {
+		return etag != "" && string(ir) == etag
+	}
+	t, err := fasthttp.ParseHTTPDate(ir)
+	return err == nil && !modTime.IsZero() && modTime.Truncate(time.Second).Equal(t)
+}
+
+// fileBody counts bytes sent to the client and calls done when fasthttp
+// closes the body stream.
+type fileBody struct {
+	r    io.Reader
+	c    io.Closer
+	n    int64
+	once sync.Once
+	done func(n int64)
+}
+
+func (b *fileBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *fileBody) Close() error {
+	var err error
+	b.once.Do(func() {
+		if b.c != nil {
+			err = b.c.Close()
+		}
+		b.done(b.n)
+	})
+	return err
+}
+
+// writeFile sets response headers and streams file f as response body. Exit
+// log record is written and metric is reported when the body is sent.
+func (e *Endpoint) writeFile(fctx *fasthttp.RequestCtx, f *File, lo LogOption, level zerolog.Level, zc zerolog.Context) error {
+
+	if f == nil || f.Content == nil {
+		return errors.NotFound("file not found")
+	}
+
+	closer, _ := f.Content.(io.Closer)
+	closeContent := func() {
+		if closer != nil {
+			closer.Close()
+		}
+	}
+
+	h := &fctx.Response.Header
+
+	// validators are needed by 304 response as well.
+	etag := f.etag()
+	if etag != "" {
+		h.Set(fasthttp.HeaderETag, etag)
+	}
+	if !f.ModTime.IsZero() {
+		h.Set(fasthttp.HeaderLastModified, string(fasthttp.AppendHTTPDate(nil, f.ModTime)))
+	}
+
+	rs, seekable := f.Content.(io.Seeker)
+	seekable = seekable && f.Size >= 0
+
+	start := fctx.Time()
+	done := func(statusCode int) func(int64) {
+		return func(n int64) {
+			dur := time.Since(start)
+			if lo&LogExit == LogExit {
+				zl := zc.Logger()
+				zl.WithLevel(level).Int("status", statusCode).Int64("size", n).Str("dur", dur.String()).Msg("file sent")
+			}
+			if e.mr != nil {
+				e.mr.ReportMetric(e.Method, e.Path, statusCode, dur.Seconds(), int(n))
+			}
+		}
+	}
+
+	if fctx.IsGet() || fctx.IsHead() {
+		e.checkNotModified(fctx, f.ModTime)
+		if fctx.Response.StatusCode() == fasthttp.StatusNotModified {
+			closeContent()
+			done(fasthttp.StatusNotModified)(0)
+			return nil
+		}
+	}
+
+	statusCode, length := fasthttp.StatusOK, f.Size
+	if rh := fctx.Request.Header.Peek(fasthttp.HeaderRange); len(rh) > 0 && seekable && (fctx.IsGet() || fctx.IsHead()) && isRangeApplicable(fctx, etag, f.ModTime) {
+		from, n, ok, err := parseRange(string(rh), f.Size)
+		if err != nil {
+			closeContent()
+			h.Del(fasthttp.HeaderETag)
+			h.Del(fasthttp.HeaderLastModified)
+			h.Set(fasthttp.HeaderContentRange, "bytes */"+strconv.FormatInt(f.Size, 10))
+			return err
+		}
+		if ok {
+			if _, err := rs.Seek(from, io.SeekStart); err != nil {
+				closeContent()
+				h.Del(fasthttp.HeaderETag)
+				h.Del(fasthttp.HeaderLastModified)
+				return err
+			}
+			h.Set(fasthttp.HeaderContentRange, "bytes "+strconv.FormatInt(from, 10)+"-"+strconv.FormatInt(from+n-1, 10)+"/"+strconv.FormatInt(f.Size, 10))
+			statusCode, length = fasthttp.StatusPartialContent, n
+		}
+	}
+
+	// headers of the file are set only if it's sent, so error response is not
+	// saved by the browser as the file.
+	ct := f.ContentType
+	if ct == "" {
+		if ct = mime.TypeByExtension(filepath.Ext(f.Name)); ct == "" {
+			ct = "application/octet-stream"
+		}
+	}
+	h.SetContentType(ct)
+	h.Set("Content-Disposition", contentDisposition(f.Inline, f.Name))
+	if seekable {
+		h.Set(fasthttp.HeaderAcceptRanges, "bytes")
+	} else {
+		h.Set(fasthttp.HeaderAcceptRanges, "none")
+	}
+
+	r := f.Content
+	if length >= 0 {
+		r = io.LimitReader(r, length)
+	}
+
+	fctx.SetStatusCode(statusCode)
+	fctx.SetBodyStream(&fileBody{r: r, c: closer, done: done(statusCode)}, int(length))
+	return nil
+}
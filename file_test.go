@@ -0,0 +1,108 @@
+package vatel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+type testFileController struct {
+	modTime time.Time
+}
+
+func (c *testFileController) Handle(Context) error { return nil }
+
+func (c *testFileController) File() *File {
+	return &File{Content: bytes.NewReader([]byte("0123456789")), Name: "отчёт 1.pdf", Size: 10, ModTime: c.modTime}
+}
+
+func TestEndpoint_writeFile(t *testing.T) {
+
+	modTime := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	etag := (&File{ModTime: modTime, Size: 10}).etag()
+	lm := string(fasthttp.AppendHTTPDate(nil, modTime))
+
+	cases := []struct {
+		headers      map[string]string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{nil, 200, "0123456789", ""},
+		{map[string]string{"Range": "bytes=2-4"}, 206, "234", "bytes 2-4/10"},
+		{map[string]string{"Range": "bytes=-3"}, 206, "789", "bytes 7-9/10"},
+		{map[string]string{"Range": "bytes=8-20"}, 206, "89", "bytes 8-9/10"},
+		{map[string]string{"Range": "bytes=20-"}, 416, "", "bytes */10"},
+		{map[string]string{"Range": "bytes=0-1,3-4"}, 200, "0123456789", ""},
+		{map[string]string{"Range": "bytes=2-4", "If-Range": `"other"`}, 200, "0123456789", ""},
+		{map[string]string{"Range": "bytes=2-4", "If-Range": etag}, 206, "234", "bytes 2-4/10"},
+		{map[string]string{"Range": "bytes=2-4", "If-Range": lm}, 206, "234", "bytes 2-4/10"},
+		{map[string]string{"If-None-Match": etag}, 304, "", ""},
+		{map[string]string{"If-Modified-Since": lm}, 304, "", ""},
+	}
+
+	for i, c := range cases {
+		mr := testMetricReporter{}
+		e := NewEndpoint("GET", "/reports/last", nil, func() Handler { return &testFileController{modTime: modTime} })
+		if err := e.compile(NewVatel(WithMetricReporter(&mr))); err != nil {
+			t.Fatal(err)
+		}
+
+		l := zerolog.Nop()
+		var fctx fasthttp.RequestCtx
+		for k, v := range c.headers {
+			fctx.Request.Header.Set(k, v)
+		}
+		e.handler(&l)(&fctx)
+
+		var buf bytes.Buffer
+		if err := fctx.Response.BodyWriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		resp := &fctx.Response
+		if resp.StatusCode() != c.status || string(resp.Header.Peek("Content-Range")) != c.contentRange {
+			t.Errorf("case %d: expected %d %q, got %d %q", i, c.status, c.contentRange, resp.StatusCode(), resp.Header.Peek("Content-Range"))
+		}
+		if c.status == 416 {
+			if len(resp.Header.Peek("Content-Disposition")) != 0 || len(resp.Header.Peek(fasthttp.HeaderETag)) != 0 ||
+				len(resp.Header.Peek(fasthttp.HeaderAcceptRanges)) != 0 || !strings.HasPrefix(string(resp.Header.ContentType()), "application/json") {
+				t.Errorf("case %d: file headers must not be sent with error: %s", i, resp.Header.String())
+			}
+			continue
+		}
+		if buf.String() != c.body || mr.statusCode != c.status {
+			t.Errorf("case %d: expected body %q, got %q, reported status %d", i, c.body, buf.String(), mr.statusCode)
+		}
+		if c.status == 304 {
+			continue
+		}
+		if string(resp.Header.Peek("Content-Disposition")) != `attachment; filename="_____ 1.pdf"; filename*=UTF-8''%D0%BE%D1%82%D1%87%D1%91%D1%82%201.pdf` {
+			t.Errorf("case %d: unexpected Content-Disposition %s", i, resp.Header.Peek("Content-Disposition"))
+		}
+		if string(resp.Header.ContentType()) != "application/pdf" || string(resp.Header.Peek("Accept-Ranges")) != "bytes" {
+			t.Errorf("case %d: unexpected headers %s", i, resp.Header.String())
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	cases := []struct {
+		inline bool
+		name   string
+		exp    string
+	}{
+		{false, "", "attachment"},
+		{true, `report "1".pdf`, `inline; filename="report _1_.pdf"`},
+		{false, "счёт; a,b:c=d@e$f&g+h.pdf", `attachment; filename="____; a,b:c=d@e$f&g+h.pdf"; filename*=UTF-8''%D1%81%D1%87%D1%91%D1%82%3B%20a%2Cb%3Ac%3Dd%40e%24f%26g%2Bh.pdf`},
+	}
+	for _, c := range cases {
+		if res := contentDisposition(c.inline, c.name); res != c.exp {
+			t.Errorf("%q: expected %s, got %s", c.name, c.exp, res)
+		}
+	}
+}
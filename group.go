@@ -0,0 +1,114 @@
+package vatel
+
+import "path"
+
+// Group holds endpoints sharing URL prefix, permissions, logging options,
+// compression flag and middlewares.
+//
+//	admin := v.Group("/admin", vatel.WithGroupPerms("Admin"), vatel.WithGroupMiddleware(vatel.AfterAuthorization, audit))
+//	admin.Add(&UserController{}, &RoleController{})
+type Group struct {
+	v        *Vatel
+	parent   *Group
+	prefix   string
+	perms    []string
+	lo       LogOption
+	compress bool
+	mdw      middlewareSet
+}
+
+// WithGroupPerms sets permissions of group's endpoints having no Perms.
+func WithGroupPerms(perms ...string) func(*Group) {
+	return func(g *Group) {
+		g.perms = append([]string{}, perms...)
+	}
+}
+
+// WithGroupLogOptions sets logging options of group's endpoints having LogOptions LogUnknown.
+func WithGroupLogOptions(lo LogOption) func(*Group) {
+	return func(g *Group) {
+		g.lo = lo
+	}
+}
+
+// WithGroupCompress turns on gzip compression of responses of all group's endpoints.
+func WithGroupCompress() func(*Group) {
+	return func(g *Group) {
+		g.compress = true
+	}
+}
+
+// WithGroupMiddleware adds group's middlewares.
+func WithGroupMiddleware(pos MiddlewarePos, f ...func(Context) error) func(*Group) {
+	return func(g *Group) {
+		g.AddMiddleware(pos, f...)
+	}
+}
+
+// Group creates group of endpoints with URL path prefix.
+func (v *Vatel) Group(prefix string, optFunc ...func(*Group)) *Group {
+	g := Group{v: v, prefix: prefix}
+	for i := range optFunc {
+		optFunc[i](&g)
+	}
+	return &g
+}
+
+// Group creates nested group. URL prefix of nested group is appended to the parent's one.
+// Permissions, logging options and compression flag are inherited if not set.
+// Middlewares of nested group are called after parent's ones.
+func (g *Group) Group(prefix string, optFunc ...func(*Group)) *Group {
+	ng := Group{
+		v:        g.v,
+		parent:   g,
+		prefix:   path.Join(g.prefix, prefix),
+		perms:    g.perms,
+		lo:       g.lo,
+		compress: g.compress,
+	}
+	for i := range optFunc {
+		optFunc[i](&ng)
+	}
+	return &ng
+}
+
+// Prefix returns URL path prefix of the group.
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// AddMiddleware adds middlewares to be called for every request of group's
+// endpoints after global middlewares.
+func (g *Group) AddMiddleware(pos MiddlewarePos, f ...func(Context) error) {
+	g.mdw[pos] = append(g.mdw[pos], f...)
+}
+
+// Add adds endpoints to the group. Endpoint's path is prefixed by group's prefix.
+func (g *Group) Add(e ...Endpointer) {
+	for i := range e {
+		for _, ep := range e[i].Endpoints() {
+			ep.Path = path.Join(g.prefix, ep.Path)
+			if len(ep.Perms) == 0 {
+				ep.Perms = g.perms
+			}
+			if ep.LogOptions == LogUnknown {
+				ep.LogOptions = g.lo
+			}
+			ep.Compress = ep.Compress || g.compress
+			ep.group = g
+			g.v.ep = append(g.v.ep, ep)
+		}
+	}
+}
+
+// middlewares returns middlewares of the group and its parents in the order of calling.
+func (g *Group) middlewares() middlewareSet {
+	var res middlewareSet
+	if g.parent != nil {
+		res = g.parent.middlewares()
+	}
+	for i := range res {
+		res[i] = append(res[i], g.mdw[i]...)
+	}
+	return res
+}
@@ -0,0 +1,79 @@
+package vatel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+type testNopController struct{}
+
+func (c *testNopController) Handle(Context) error { return nil }
+
+func TestGroup(t *testing.T) {
+
+	var calls []string
+	mw := func(name string) func(Context) error {
+		return func(Context) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	v := NewVatel(WithUrlPrefix("/api"))
+	v.DisableAuthorizer()
+	v.AddMiddleware(AfterAuthorization, mw("global"))
+
+	admin := v.Group("/admin", WithGroupPerms("Admin"), WithGroupLogOptions(LogSilent), WithGroupCompress(),
+		WithGroupMiddleware(AfterAuthorization, mw("admin")))
+	users := admin.Group("/users")
+	users.AddMiddleware(AfterAuthorization, mw("users"))
+
+	users.Add(endpoints{
+		{Method: "GET", Path: "/", Controller: func() Handler { return &testNopController{} },
+			Middlewares: map[MiddlewarePos][]func(Context) error{AfterAuthorization: {mw("endpoint")}}},
+		{Method: "POST", Path: "/", Perms: []string{"UserCreate"}, LogOptions: LogFull, Controller: func() Handler { return &testNopController{} }},
+	})
+
+	if users.Prefix() != "/admin/users" {
+		t.Errorf("unexpected prefix: %s", users.Prefix())
+	}
+
+	r := router.New()
+	l := zerolog.Nop()
+	if err := v.BuildHandlers(r, &l); err != nil {
+		t.Fatal(err)
+	}
+
+	var get, post *Endpoint
+	for i := range v.ep {
+		switch v.ep[i].Method + " " + v.ep[i].Path {
+		case "GET /api/admin/users":
+			get = &v.ep[i]
+		case "POST /api/admin/users":
+			post = &v.ep[i]
+		}
+	}
+	if get == nil || post == nil {
+		t.Fatalf("endpoints not found: %+v", v.ep)
+	}
+
+	if strings.Join(get.Perms, ",") != "Admin" || get.LogOptions != LogSilent || !get.Compress {
+		t.Errorf("group defaults expected: %v %d %t", get.Perms, get.LogOptions, get.Compress)
+	}
+	if strings.Join(post.Perms, ",") != "UserCreate" || post.LogOptions != LogFull {
+		t.Errorf("endpoint's attributes expected: %v %d", post.Perms, post.LogOptions)
+	}
+
+	var fctx fasthttp.RequestCtx
+	fctx.Request.Header.SetMethod("GET")
+	fctx.Request.SetRequestURI("/api/admin/users")
+	r.Handler(&fctx)
+
+	if strings.Join(calls, ",") != "global,admin,users,endpoint" {
+		t.Errorf("unexpected middleware calls: %v", calls)
+	}
+}
@@ -0,0 +1,207 @@
+package vatel
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/axkit/errors"
+	"github.com/valyala/fasthttp"
+)
+
+// IdempotencyKeyHeader is the name of request header holding idempotency key.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// DefaultIdempotencyTTL is the default period of keeping responses of idempotent endpoints.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+var (
+	ErrIdempotencyKeyInUse    = errors.New("request with the same idempotency key is in progress").Code("VTL-0009").StatusCode(409)
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key was used with different request body").Code("VTL-0010").StatusCode(422)
+)
+
+// StoredResponse holds HTTP response saved to be replayed.
+type StoredResponse struct {
+	StatusCode int
+	Header     [][2]string
+	Body       []byte
+}
+
+// captureResponse returns copy of the response. Headers set by server
+// (Date, Server, etc), CORS headers, rate limit headers and cookies are not copied.
+func captureResponse(fctx *fasthttp.RequestCtx) *StoredResponse {
+	resp := StoredResponse{
+		StatusCode: fctx.Response.StatusCode(),
+		Body:       append([]byte{}, fctx.Response.Body()...),
+	}
+	fctx.Response.Header.VisitAll(func(k, v []byte) {
+		switch string(k) {
+		case fasthttp.HeaderContentLength, fasthttp.HeaderDate, fasthttp.HeaderServer, fasthttp.HeaderConnection, fasthttp.HeaderSetCookie, fasthttp.HeaderVary, fasthttp.HeaderRetryAfter:
+			return
+		}
+		if bytes.HasPrefix(k, []byte("Access-Control-")) || bytes.HasPrefix(bytes.ToLower(k), []byte("x-ratelimit-")) {
+			return
+		}
+		resp.Header = append(resp.Header, [2]string{string(k), string(v)})
+	})
+	return &resp
+}
+
+// write writes stored response to the response of fctx.
+func (resp *StoredResponse) write(fctx *fasthttp.RequestCtx) {
+	for _, h := range resp.Header {
+		fctx.Response.Header.Set(h[0], h[1])
+	}
+	fctx.SetStatusCode(resp.StatusCode)
+	fctx.Response.SetBody(resp.Body)
+}
+
+// IdempotencyRecord holds state of the request having idempotency key.
+type IdempotencyRecord struct {
+	// Fingerprint is the hash of request body.
+	Fingerprint string
+
+	// Response is nil while request is in progress.
+	Response *StoredResponse
+}
+
+// IdempotencyStore is the interface what wraps methods of idempotency keys storage.
+//
+// Begin reserves key for the request with body fingerprint. If the key
+// is already reserved, it returns existing record and started false.
+//
+// Complete saves response of the request. The key is kept until ttl passed to Begin expires.
+//
+// Cancel removes the key if request failed, so it can be retried.
+type IdempotencyStore interface {
+	Begin(key, fingerprint string, ttl time.Duration) (rec IdempotencyRecord, started bool, err error)
+	Complete(key string, resp *StoredResponse) error
+	Cancel(key string) error
+}
+
+// SetIdempotencyStore assigns storage of idempotency keys. If store is not
+// assigned, idempotent endpoints use in-memory storage.
+func (v *Vatel) SetIdempotencyStore(s IdempotencyStore) {
+	v.ids = s
+}
+
+// MemoryIdempotencyStore implements IdempotencyStore keeping records in memory.
+type MemoryIdempotencyStore struct {
+	mu          sync.Mutex
+	records     map[string]*idempotencyEntry
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+type idempotencyEntry struct {
+	rec     IdempotencyRecord
+	expires time.Time
+}
+
+// memoryIdempotencyCleanupPeriod defines how often expired records are removed from memory.
+const memoryIdempotencyCleanupPeriod = time.Minute
+
+// NewMemoryIdempotencyStore returns new in-memory storage of idempotency keys.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]*idempotencyEntry), now: time.Now}
+}
+
+// Begin implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Begin(key, fingerprint string, ttl time.Duration) (IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastCleanup) > memoryIdempotencyCleanupPeriod {
+		for k, e := range s.records {
+			if now.After(e.expires) {
+				delete(s.records, k)
+			}
+		}
+		s.lastCleanup = now
+	}
+
+	if e, ok := s.records[key]; ok && now.Before(e.expires) {
+		return e.rec, false, nil
+	}
+
+	rec := IdempotencyRecord{Fingerprint: fingerprint}
+	s.records[key] = &idempotencyEntry{rec: rec, expires: now.Add(ttl)}
+	return rec, true, nil
+}
+
+// Complete implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Complete(key string, resp *StoredResponse) error {
+	s.mu.Lock()
+	if e, ok := s.records[key]; ok {
+		e.rec.Response = resp
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Cancel implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Cancel(key string) error {
+	s.mu.Lock()
+	delete(s.records, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// idempotencyKey returns storage key of the request's idempotency key scoped by
+// request path and user. Returns empty string if request has no idempotency key.
+// Request body is compared by fingerprint of IdempotencyRecord.
+func (e *Endpoint) idempotencyKey(fctx *fasthttp.RequestCtx, tp TokenPayloader) string {
+	k := fctx.Request.Header.Peek(IdempotencyKeyHeader)
+	if len(k) == 0 {
+		return ""
+	}
+
+	user := ""
+	if tp != nil {
+		user = tp.User().String() + ":" + tp.Login()
+	}
+	return e.Method + " " + string(fctx.Path()) + " " + user + " " + string(k)
+}
+
+// beginIdempotent reserves idempotency key of the request. If the request was already
+// processed, the stored response is written and replayed is true.
+func (e *Endpoint) beginIdempotent(ctx Context, key string) (replayed bool, err error) {
+
+	fctx := ctx.RequestCtx()
+	sum := sha256.Sum256(fctx.Request.Body())
+	fp := hex.EncodeToString(sum[:])
+
+	ttl := e.IdempotencyTTL
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+
+	rec, started, err := e.ids.Begin(key, fp, ttl)
+	switch {
+	case err != nil:
+		return false, errors.Catch(err).StatusCode(500).Msg("idempotency key check failed")
+	case started:
+		return false, nil
+	case rec.Fingerprint != fp:
+		return false, ErrIdempotencyKeyMismatch.Capture()
+	case rec.Response == nil:
+		return false, ErrIdempotencyKeyInUse.Capture()
+	}
+
+	rec.Response.write(fctx)
+	fctx.Response.Header.Set("Idempotent-Replayed", "true")
+	return true, nil
+}
+
+// finishIdempotent saves the response of the request if it's succeeded, otherwise
+// releases idempotency key.
+func (e *Endpoint) finishIdempotent(fctx *fasthttp.RequestCtx, key string, succeeded bool) error {
+	if !succeeded {
+		return e.ids.Cancel(key)
+	}
+
+	return e.ids.Complete(key, captureResponse(fctx))
+}
@@ -0,0 +1,134 @@
+package vatel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+type testPaymentController struct {
+	calls *int
+	in    struct {
+		Amount int `json:"amount"`
+	}
+	res struct {
+		ID int `json:"id"`
+	}
+}
+
+func (c *testPaymentController) Input() interface{}  { return &c.in }
+func (c *testPaymentController) Result() interface{} { return &c.res }
+func (c *testPaymentController) Handle(ctx Context) error {
+	*c.calls++
+	c.res.ID = *c.calls
+	ctx.SetHeader([]byte("X-Payment"), []byte(strconv.Itoa(c.res.ID)))
+	return nil
+}
+
+type testAccountPaymentController struct {
+	testPaymentController
+	param struct {
+		ID int `param:"id"`
+	}
+}
+
+func (c *testAccountPaymentController) Param() interface{} { return &c.param }
+
+func TestEndpoint_Idempotent(t *testing.T) {
+
+	calls := 0
+	mr := testMetricReporter{}
+	v := newTestVatel(WithMetricReporter(&mr))
+	e := Endpoint{Method: "POST", Path: "/payments", Perms: []string{"Pay"}, Idempotent: true,
+		Controller: func() Handler { return &testPaymentController{calls: &calls} }}
+	if err := e.compile(v); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	h := e.handler(&l)
+
+	request := func(login, key, body string) *fasthttp.RequestCtx {
+		var fctx fasthttp.RequestCtx
+		fctx.Request.SetRequestURI("/payments")
+		fctx.Request.Header.Set("Authorization", login)
+		fctx.Request.Header.Set(IdempotencyKeyHeader, key)
+		fctx.Request.SetBody([]byte(body))
+		h(&fctx)
+		return &fctx
+	}
+
+	first := request("john", "k1", `{"amount":10}`)
+	if first.Response.StatusCode() != 201 || string(first.Response.Body()) != `{"id":1}` {
+		t.Fatalf("unexpected response: %d %s", first.Response.StatusCode(), first.Response.Body())
+	}
+
+	mr.statusCode = 0
+	second := request("john", "k1", `{"amount":10}`)
+	if mr.statusCode != 201 {
+		t.Errorf("metric of replayed response expected, got status %d", mr.statusCode)
+	}
+	if calls != 1 || second.Response.StatusCode() != 201 || string(second.Response.Body()) != `{"id":1}` ||
+		string(second.Response.Header.Peek("X-Payment")) != "1" || string(second.Response.Header.Peek("Idempotent-Replayed")) != "true" {
+		t.Fatalf("replayed response expected, got: %d %s %s", second.Response.StatusCode(), second.Response.Header.String(), second.Response.Body())
+	}
+
+	if fctx := request("john", "k1", `{"amount":20}`); fctx.Response.StatusCode() != 422 {
+		t.Errorf("expected 422, got %d", fctx.Response.StatusCode())
+	}
+
+	// the key is scoped by user.
+	if fctx := request("mary", "k1", `{"amount":10}`); fctx.Response.StatusCode() != 201 || calls != 2 {
+		t.Errorf("expected new payment, got %d, calls %d", fctx.Response.StatusCode(), calls)
+	}
+
+	// request in progress.
+	fp := sha256.Sum256([]byte(`{"amount":10}`))
+	v.ids.Begin("POST /payments "+(&testPayload{login: "john"}).User().String()+":john k2", hex.EncodeToString(fp[:]), time.Minute)
+	if fctx := request("john", "k2", `{"amount":10}`); fctx.Response.StatusCode() != 409 {
+		t.Errorf("expected 409, got %d", fctx.Response.StatusCode())
+	}
+
+	// failed request releases the key.
+	if fctx := request("john", "k3", `{"amount":`); fctx.Response.StatusCode() < 400 {
+		t.Fatalf("error expected, got %d", fctx.Response.StatusCode())
+	}
+	if fctx := request("john", "k3", `{"amount":`); string(fctx.Response.Header.Peek("Idempotent-Replayed")) != "" {
+		t.Error("failed response must not be replayed")
+	}
+
+	// the key is scoped by actual path, not by the route.
+	e = Endpoint{Method: "POST", Path: "/accounts/{id}/payments", Perms: []string{"Pay"}, Idempotent: true,
+		Controller: func() Handler {
+			return &testAccountPaymentController{testPaymentController: testPaymentController{calls: &calls}}
+		}}
+	if err := e.compile(v); err != nil {
+		t.Fatal(err)
+	}
+	h = e.handler(&l)
+
+	for i, id := range []string{"1", "2", "1"} {
+		uri := "/accounts/" + id + "/payments"
+		var fctx fasthttp.RequestCtx
+		fctx.Request.SetRequestURI(uri)
+		fctx.SetUserValue("id", id)
+		fctx.Request.Header.Set("Authorization", "john")
+		fctx.Request.Header.Set(IdempotencyKeyHeader, "k4")
+		fctx.Request.SetBody([]byte(`{"amount":10}`))
+		h(&fctx)
+		replayed := string(fctx.Response.Header.Peek("Idempotent-Replayed")) == "true"
+		if fctx.Response.StatusCode() != 201 || replayed != (i == 2) {
+			t.Errorf("%s: unexpected response %d, replayed %t", uri, fctx.Response.StatusCode(), replayed)
+		}
+	}
+
+	e = Endpoint{Method: "GET", Path: "/payments", Idempotent: true, Controller: func() Handler { return &testNopController{} }}
+	if err := e.compile(v); err == nil {
+		t.Error("error expected for idempotent GET")
+	}
+}
@@ -0,0 +1,201 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golangkit/vatel"
+	"github.com/google/uuid"
+)
+
+// DefaultAccessTokenTTL is the default lifetime of issued access tokens.
+const DefaultAccessTokenTTL = 15 * time.Minute
+
+// PayloadClaimsBuilder converts vatel.TokenPayloader to claims of issued token.
+type PayloadClaimsBuilder func(p vatel.TokenPayloader) Claims
+
+// WithPayloadClaims sets conversion of vatel.TokenPayloader to claims of issued
+// tokens. Default is PayloadClaims.
+func WithPayloadClaims(b PayloadClaimsBuilder) func(*Option) {
+	return func(o *Option) {
+		o.builder = b
+	}
+}
+
+// WithAccessTokenTTL sets lifetime of issued access tokens. Default is DefaultAccessTokenTTL.
+func WithAccessTokenTTL(d time.Duration) func(*Option) {
+	return func(o *Option) {
+		o.ttl = d
+	}
+}
+
+// PayloadClaims returns claims what are converted back by DefaultClaimsMapper.
+func PayloadClaims(p vatel.TokenPayloader) Claims {
+	c := Claims{}
+	if p.User() != uuid.Nil {
+		c["sub"] = p.User().String()
+	}
+	if p.Login() != "" {
+		c["login"] = p.Login()
+	}
+	c["role"] = p.Role()
+	if len(p.Perms()) > 0 {
+		c["perms"] = base64.StdEncoding.EncodeToString(p.Perms())
+	}
+	if p.Extra() != nil {
+		c["extra"] = p.Extra()
+	}
+	if p.Debug() {
+		c["debug"] = true
+	}
+	return c
+}
+
+// Issuer signs access tokens. It implements vatel.TokenIssuer.
+//
+// Options WithIssuer, WithAudience and WithClock define claims iss, aud and
+// iat of issued tokens.
+type Issuer struct {
+	cfg    Option
+	alg    string
+	kid    string
+	header string
+	key    interface{}
+}
+
+var _ vatel.TokenIssuer = (*Issuer)(nil)
+
+// NewIssuer returns Issuer signing tokens by algorithm alg and key k. Key must be
+// []byte for HS algorithms, *rsa.PrivateKey for RS and PS, *ecdsa.PrivateKey
+// for ES and ed25519.PrivateKey for EdDSA. If kid is not empty, it's added
+// to the token header.
+func NewIssuer(alg, kid string, k interface{}, optFunc ...func(*Option)) (*Issuer, error) {
+
+	iss := Issuer{
+		cfg: Option{
+			ttl:     DefaultAccessTokenTTL,
+			builder: PayloadClaims,
+			now:     time.Now,
+		},
+		alg: alg,
+		kid: kid,
+		key: k,
+	}
+
+	for i := range optFunc {
+		optFunc[i](&iss.cfg)
+	}
+
+	var pub interface{}
+	switch pk := k.(type) {
+	case []byte:
+		pub = pk
+	case *rsa.PrivateKey:
+		pub = &pk.PublicKey
+	case *ecdsa.PrivateKey:
+		pub = &pk.PublicKey
+	case ed25519.PrivateKey:
+		pub = pk.Public()
+	}
+	if _, ok := algorithms[alg]; !ok || !isKeyCompatible(alg, pub) {
+		return nil, fmt.Errorf("jwt: key %T is not suitable for algorithm %q", k, alg)
+	}
+
+	h := header{Alg: alg, Kid: kid, Typ: "JWT"}
+	buf, err := json.Marshal(&h)
+	if err != nil {
+		return nil, err
+	}
+	iss.header = base64.RawURLEncoding.EncodeToString(buf)
+	return &iss, nil
+}
+
+// IssueToken implements vatel.TokenIssuer interface. Returns signed token
+// carrying claims of payload p and its expiration time.
+func (iss *Issuer) IssueToken(p vatel.TokenPayloader) (string, time.Time, error) {
+
+	now := iss.cfg.now()
+	exp := now.Add(iss.cfg.ttl)
+
+	c := iss.cfg.builder(p)
+	if c == nil {
+		c = Claims{}
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", time.Time{}, err
+	}
+	c["jti"] = hex.EncodeToString(jti)
+	c["iat"] = now.Unix()
+	c["exp"] = exp.Unix()
+	if iss.cfg.issuer != "" {
+		c["iss"] = iss.cfg.issuer
+	}
+	switch len(iss.cfg.audience) {
+	case 0:
+	case 1:
+		c["aud"] = iss.cfg.audience[0]
+	default:
+		c["aud"] = iss.cfg.audience
+	}
+
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signed := iss.header + "." + base64.RawURLEncoding.EncodeToString(buf)
+	sig, err := sign(iss.alg, iss.key, []byte(signed))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), time.Unix(exp.Unix(), 0), nil
+}
+
+// sign returns signature of signed by private key k.
+func sign(alg string, k interface{}, signed []byte) ([]byte, error) {
+
+	a := algorithms[alg]
+	switch a.kind {
+	case "EdDSA":
+		return ed25519.Sign(k.(ed25519.PrivateKey), signed), nil
+	case "HS":
+		m := hmac.New(a.hash.New, k.([]byte))
+		m.Write(signed)
+		return m.Sum(nil), nil
+	}
+
+	h := a.hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch a.kind {
+	case "RS":
+		return rsa.SignPKCS1v15(rand.Reader, k.(*rsa.PrivateKey), a.hash, digest)
+	case "PS":
+		return rsa.SignPSS(rand.Reader, k.(*rsa.PrivateKey), a.hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	}
+
+	pk := k.(*ecdsa.PrivateKey)
+	r, s, err := ecdsa.Sign(rand.Reader, pk, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	// R and S are left padded to the curve size (RFC 7518, 3.4).
+	size := (pk.Curve.Params().BitSize + 7) / 8
+	sig := make([]byte, 2*size)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(sig[size-len(rb):size], rb)
+	copy(sig[2*size-len(sb):], sb)
+	return sig, nil
+}
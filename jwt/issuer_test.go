@@ -0,0 +1,89 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestIssuer_IssueToken(t *testing.T) {
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ek, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	_, edk, _ := ed25519.GenerateKey(rand.Reader)
+
+	p := Payload{UserID: uuid.New(), LoginName: "john", RoleID: 3, PermSet: []byte{0x01, 0xff}, DebugFlag: true}
+
+	for _, c := range []struct {
+		alg string
+		key interface{}
+	}{
+		{"HS256", secret},
+		{"HS512", secret},
+		{"RS256", rk},
+		{"PS256", rk},
+		{"PS512", rk},
+		{"ES512", ek},
+		{"EdDSA", edk},
+	} {
+		iss, err := NewIssuer(c.alg, "k1", c.key, WithClock(testClock), WithIssuer("https://auth.example.com"),
+			WithAudience("billing"), WithAccessTokenTTL(10*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tok, exp, err := iss.IssueToken(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exp.Equal(testNow.Add(10 * time.Minute)) {
+			t.Errorf("%s: unexpected expiration %s", c.alg, exp)
+		}
+
+		d, err := New(WithKey("k1", c.key), WithClock(testClock), WithIssuer("https://auth.example.com"), WithAudience("billing"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := d.Decode([]byte(tok))
+		if err != nil {
+			t.Errorf("%s: issued token rejected: %v", c.alg, err)
+			continue
+		}
+
+		rp := res.ApplicationPayload()
+		if rp.User() != p.UserID || rp.Login() != "john" || rp.Role() != 3 || string(rp.Perms()) != "\x01\xff" || !rp.Debug() {
+			t.Errorf("%s: unexpected payload %+v", c.alg, rp)
+		}
+		if res.SystemPayload()["jti"] == nil {
+			t.Errorf("%s: jti expected", c.alg)
+		}
+	}
+
+	// PSS signatures must use salt of the hash length (RFC 7518, 3.5).
+	iss, _ := NewIssuer("PS256", "", rk, WithClock(testClock))
+	tok, _, _ := iss.IssueToken(&p)
+	parts := strings.Split(tok, ".")
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	h := crypto.SHA256.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPSS(&rk.PublicKey, crypto.SHA256, h.Sum(nil), sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+		t.Errorf("PSS salt length mismatch: %v", err)
+	}
+
+	if _, err := NewIssuer("RS256", "", secret); err == nil {
+		t.Error("error expected for HMAC secret with RS256")
+	}
+	if _, err := NewIssuer("none", "", secret); err == nil {
+		t.Error("error expected for algorithm none")
+	}
+}
@@ -0,0 +1,253 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync/atomic"
+)
+
+// maxJWKSSize is the maximum size of JWKS document.
+const maxJWKSSize = 1 << 20
+
+// key is a verification key. Public is one of []byte (HMAC secret),
+// *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+type key struct {
+	id     string
+	alg    string
+	public interface{}
+}
+
+// jwk holds JSON Web Key attributes (RFC 7517) used for signature verification.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS parses JWK Set document. Keys not intended for signatures and
+// keys of unknown types are skipped.
+func parseJWKS(buf []byte) ([]key, error) {
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return nil, fmt.Errorf("jwt: invalid JWKS: %w", err)
+	}
+
+	res := make([]key, 0, len(doc.Keys))
+	for i := range doc.Keys {
+		k := &doc.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwt: invalid JWKS key %q: %w", k.Kid, err)
+		}
+		if pub == nil {
+			continue
+		}
+		res = append(res, key{id: k.Kid, alg: k.Alg, public: pub})
+	}
+	return res, nil
+}
+
+// publicKey returns verification key. Returns nil if key type is not supported.
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		return decodeSegment(k.K)
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var c elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			c = elliptic.P256()
+		case "P-384":
+			c = elliptic.P384()
+		case "P-521":
+			c = elliptic.P521()
+		default:
+			return nil, nil
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !c.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: c, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	buf, err := decodeSegment(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) == 0 {
+		return nil, fmt.Errorf("empty integer")
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
+// fileSource returns function reading JWKS document from the file.
+func fileSource(path string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		return ioutil.ReadFile(path)
+	}
+}
+
+// urlSource returns function fetching JWKS document by HTTP GET.
+func urlSource(c *http.Client, url string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		resp, err := c.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("jwt: JWKS %s responded with status %d", url, resp.StatusCode)
+		}
+		buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxJWKSSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) > maxJWKSSize {
+			return nil, fmt.Errorf("jwt: JWKS %s is too large", url)
+		}
+		return buf, nil
+	}
+}
+
+// refreshStaleKeys starts reloading of JWKS keys in background if they are stale.
+// Previously loaded keys are used until reloading completes.
+func (d *Decoder) refreshStaleKeys() {
+	if d.cfg.source == nil || !d.isReloadRequired(false) || !atomic.CompareAndSwapInt32(&d.refreshing, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&d.refreshing, 0)
+		d.reloadKeys(false)
+	}()
+}
+
+// reloadKeys loads JWKS keys if the source is defined and the keys are stale or
+// force is true. Loading is not repeated more often than DefaultJWKSMinReload.
+// Previously loaded keys are kept if loading fails.
+func (d *Decoder) reloadKeys(force bool) error {
+	if d.cfg.source == nil || !d.isReloadRequired(force) {
+		return nil
+	}
+
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	// keys could be reloaded by another goroutine while waiting for the lock.
+	if !d.isReloadRequired(force) {
+		return nil
+	}
+
+	d.mu.Lock()
+	d.loadedAt = d.cfg.now()
+	d.mu.Unlock()
+
+	return d.loadKeys()
+}
+
+func (d *Decoder) isReloadRequired(force bool) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	age := d.cfg.now().Sub(d.loadedAt)
+	return age >= d.cfg.refresh || force && age >= DefaultJWKSMinReload
+}
+
+// loadKeys reads and parses JWKS document.
+func (d *Decoder) loadKeys() error {
+	buf, err := d.cfg.source()
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(buf)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.jwks = keys
+	d.mu.Unlock()
+	return nil
+}
+
+// findKeys returns keys matching kid and suitable for algorithm alg. If kid
+// is empty, all keys suitable for alg are returned.
+func (d *Decoder) findKeys(kid, alg string) []key {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var res []key
+	for _, ks := range [][]key{d.cfg.keys, d.jwks} {
+		for i := range ks {
+			k := ks[i]
+			if kid != "" && k.id != kid || k.alg != "" && k.alg != alg || !isKeyCompatible(alg, k.public) {
+				continue
+			}
+			res = append(res, k)
+		}
+	}
+	return res
+}
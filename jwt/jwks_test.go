@@ -0,0 +1,193 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testJWK(kid string, k interface{}) map[string]string {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch pk := k.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": enc(pk.N.Bytes()), "e": enc(big.NewInt(int64(pk.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": kid, "crv": pk.Curve.Params().Name, "x": enc(pk.X.Bytes()), "y": enc(pk.Y.Bytes())}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": enc(pk)}
+	case []byte:
+		return map[string]string{"kty": "oct", "kid": kid, "k": enc(pk)}
+	}
+	return nil
+}
+
+func testJWKS(keys ...map[string]string) []byte {
+	buf, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	return buf
+}
+
+func TestDecoder_jwksFile(t *testing.T) {
+
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ek, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	epk, edk, _ := ed25519.GenerateKey(rand.Reader)
+
+	enc := testJWK("enc", &rk.PublicKey)
+	enc["use"] = "enc"
+
+	f, err := ioutil.TempFile("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(testJWKS(testJWK("rs", &rk.PublicKey), testJWK("es", &ek.PublicKey), testJWK("ed", epk), enc,
+		map[string]string{"kty": "EC", "kid": "x25519", "crv": "X25519"}))
+	f.Close()
+
+	d, err := New(WithJWKSFile(f.Name()), WithClock(testClock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		alg, kid string
+		key      interface{}
+		ok       bool
+	}{
+		{"RS256", "rs", rk, true},
+		{"ES256", "es", ek, true},
+		{"EdDSA", "ed", edk, true},
+		{"RS256", "enc", rk, false},
+		{"ES384", "es", ek, false},
+		{"RS256", "", rk, true},
+	} {
+		_, err := d.Decode([]byte(testSign(t, c.alg, c.kid, c.key, testClaims(nil))))
+		if (err == nil) != c.ok {
+			t.Errorf("%s %s: expected ok %t, got error %v", c.alg, c.kid, c.ok, err)
+		}
+	}
+
+	if _, err := New(WithJWKSFile(f.Name() + ".missed")); err == nil {
+		t.Error("error expected for missed JWKS file")
+	}
+}
+
+func TestDecoder_jwksURLRotation(t *testing.T) {
+
+	k1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	k2, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	var mu sync.Mutex
+	jwks := testJWKS(testJWK("k1", &k1.PublicKey))
+	hits := 0
+	gate := make(chan struct{})
+	close(gate)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		g := gate
+		mu.Unlock()
+		<-g
+
+		mu.Lock()
+		defer mu.Unlock()
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jwks)
+	}))
+	defer srv.Close()
+
+	now := testNow
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+
+	// waitRefresh waits for background reloading of stale keys.
+	waitRefresh := func(d *Decoder) {
+		for i := 0; i < 200 && atomic.LoadInt32(&d.refreshing) == 1; i++ {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	d, err := New(WithJWKSURL(srv.URL), WithHTTPClient(srv.Client()), WithClock(clock), WithClockSkew(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok1 := testSign(t, "RS256", "k1", k1, testClaims(nil))
+	tok2 := testSign(t, "ES384", "k2", k2, testClaims(nil))
+
+	if _, err := d.Decode([]byte(tok1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// key k2 is published.
+	mu.Lock()
+	jwks = testJWKS(testJWK("k1", &k1.PublicKey), testJWK("k2", &k2.PublicKey))
+	mu.Unlock()
+
+	// unknown kid does not cause reloading within DefaultJWKSMinReload.
+	if _, err := d.Decode([]byte(tok2)); err == nil {
+		t.Error("token with unknown kid accepted")
+	}
+
+	advance(DefaultJWKSMinReload)
+	if _, err := d.Decode([]byte(tok2)); err != nil {
+		t.Errorf("token signed by rotated key rejected: %v", err)
+	}
+
+	// key k1 is revoked, periodic refresh removes it.
+	mu.Lock()
+	jwks = testJWKS(testJWK("k2", &k2.PublicKey))
+	mu.Unlock()
+
+	// stale keys are used while the periodic refresh is in progress.
+	mu.Lock()
+	gate = make(chan struct{})
+	mu.Unlock()
+	advance(DefaultJWKSRefresh)
+	if _, err := d.Decode([]byte(tok1)); err != nil {
+		t.Errorf("stale keys must be used while refreshing: %v", err)
+	}
+	mu.Lock()
+	close(gate)
+	mu.Unlock()
+	waitRefresh(d)
+	if _, err := d.Decode([]byte(tok1)); err == nil {
+		t.Error("token signed by revoked key accepted")
+	}
+
+	mu.Lock()
+	if hits != 3 {
+		t.Errorf("expected 3 JWKS requests, got %d", hits)
+	}
+	mu.Unlock()
+
+	srv.Close()
+	advance(DefaultJWKSRefresh)
+	d.Decode([]byte(tok2))
+	waitRefresh(d)
+	if _, err := d.Decode([]byte(tok2)); err != nil {
+		t.Errorf("keys loaded before must be used if JWKS is unavailable: %v", err)
+	}
+}
@@ -0,0 +1,671 @@
+// Package jwt implements vatel.TokenDecoder verifying JSON Web Tokens (RFC 7519)
+// by the standard library crypto.
+//
+//	td, err := jwt.New(jwt.WithJWKSURL("https://auth.example.com/.well-known/jwks.json"),
+//		jwt.WithIssuer("https://auth.example.com"),
+//		jwt.WithAudience("billing"))
+//	if err != nil {
+//		return err
+//	}
+//	v.SetTokenDecoder(td)
+//	v.SetTokenExtractor(vatel.AuthorizationToken("Bearer"))
+//
+// Supported algorithms are HS256, HS384, HS512, RS256, RS384, RS512, PS256,
+// PS384, PS512, ES256, ES384, ES512 and EdDSA (Ed25519). Algorithm "none" is
+// never accepted. Keys are taken from a JWK Set (file or URL) and keys given
+// by WithKey, the key is selected by header "kid". Token without "kid" is
+// verified by every key compatible with its algorithm. If the token refers to
+// unknown kid, JWK Set is reloaded to pick up rotated keys.
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // hash functions registration.
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/axkit/errors"
+	"github.com/golangkit/vatel"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultClockSkew is the default tolerance of exp, nbf and iat validation.
+	DefaultClockSkew = 30 * time.Second
+
+	// DefaultJWKSRefresh is the default period of JWK Set reloading.
+	DefaultJWKSRefresh = time.Hour
+
+	// DefaultJWKSMinReload is the minimal period between JWK Set reloads
+	// caused by tokens with unknown kid.
+	DefaultJWKSMinReload = time.Minute
+
+	// maxTokenSize is the maximum size of encoded token.
+	maxTokenSize = 8 << 10
+
+	// minRSAKeyBits is the minimal size of accepted RSA keys.
+	minRSAKeyBits = 2048
+)
+
+// Error codes of rejected tokens. Errors have status code 401.
+const (
+	CodeTokenMalformed   = "VTL-0015"
+	CodeSignatureInvalid = "VTL-0016"
+	CodeTokenExpired     = "VTL-0017"
+	CodeTokenNotActive   = "VTL-0018"
+	CodeClaimsInvalid    = "VTL-0019"
+)
+
+// unauthorized returns new error. Errors are not predefined as variables because
+// vatel's authorization wraps and modifies them.
+func unauthorized(code, msg string) *errors.CatchedError {
+	return errors.New(msg).Code(code).StatusCode(401)
+}
+
+// Option holds Decoder and Issuer settings.
+type Option struct {
+	keys      []key
+	source    func() ([]byte, error)
+	client    *http.Client
+	jwksFile  string
+	jwksURL   string
+	refresh   time.Duration
+	algs      map[string]bool
+	skew      time.Duration
+	audience  []string
+	issuer    string
+	mapper    ClaimsMapper
+	now       func() time.Time
+	keyErrors []error
+
+	// Issuer settings.
+	ttl     time.Duration
+	builder PayloadClaimsBuilder
+}
+
+// WithKey adds verification key identified by kid. Key must be []byte (HMAC
+// secret), *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey. Token having
+// header kid is verified only by keys with the same kid. Token without header
+// kid is verified by all keys compatible with its algorithm, whatever their kid.
+func WithKey(kid string, k interface{}) func(*Option) {
+	return func(o *Option) {
+		switch pk := k.(type) {
+		case []byte, *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		case *rsa.PrivateKey:
+			k = &pk.PublicKey
+		case *ecdsa.PrivateKey:
+			k = &pk.PublicKey
+		case ed25519.PrivateKey:
+			k = pk.Public()
+		default:
+			o.keyErrors = append(o.keyErrors, fmt.Errorf("jwt: unsupported key type %T", k))
+			return
+		}
+		o.keys = append(o.keys, key{id: kid, public: k})
+	}
+}
+
+// WithJWKSFile sets path of JWK Set document.
+func WithJWKSFile(path string) func(*Option) {
+	return func(o *Option) {
+		o.jwksFile = path
+	}
+}
+
+// WithJWKSURL sets URL of JWK Set document.
+func WithJWKSURL(url string) func(*Option) {
+	return func(o *Option) {
+		o.jwksURL = url
+	}
+}
+
+// WithJWKSRefresh sets period of JWK Set reloading. Default is DefaultJWKSRefresh.
+// Stale JWK Set is reloaded in background, tokens are verified by previously
+// loaded keys meanwhile.
+func WithJWKSRefresh(d time.Duration) func(*Option) {
+	return func(o *Option) {
+		o.refresh = d
+	}
+}
+
+// WithHTTPClient sets HTTP client used for JWK Set fetching.
+// Default is http.Client with 10 seconds timeout.
+func WithHTTPClient(c *http.Client) func(*Option) {
+	return func(o *Option) {
+		o.client = c
+	}
+}
+
+// WithAlgorithms limits accepted signature algorithms. By default all
+// supported algorithms are accepted if the key type matches.
+func WithAlgorithms(alg ...string) func(*Option) {
+	return func(o *Option) {
+		o.algs = make(map[string]bool, len(alg))
+		for _, a := range alg {
+			o.algs[a] = true
+		}
+	}
+}
+
+// WithClockSkew sets tolerance of exp, nbf and iat validation. Default is DefaultClockSkew.
+func WithClockSkew(d time.Duration) func(*Option) {
+	return func(o *Option) {
+		o.skew = d
+	}
+}
+
+// WithAudience requires claim aud to contain any of aud.
+func WithAudience(aud ...string) func(*Option) {
+	return func(o *Option) {
+		o.audience = aud
+	}
+}
+
+// WithIssuer requires claim iss to be equal iss.
+func WithIssuer(iss string) func(*Option) {
+	return func(o *Option) {
+		o.issuer = iss
+	}
+}
+
+// WithClaimsMapper sets conversion of claims to vatel.TokenPayloader.
+// Default is DefaultClaimsMapper.
+func WithClaimsMapper(m ClaimsMapper) func(*Option) {
+	return func(o *Option) {
+		o.mapper = m
+	}
+}
+
+// WithClock sets function returning current time. Default is time.Now.
+func WithClock(now func() time.Time) func(*Option) {
+	return func(o *Option) {
+		o.now = now
+	}
+}
+
+// Decoder verifies and decodes JWT. It implements vatel.TokenDecoder.
+type Decoder struct {
+	cfg Option
+
+	reloadMu   sync.Mutex
+	mu         sync.RWMutex
+	jwks       []key
+	loadedAt   time.Time
+	refreshing int32
+}
+
+var _ vatel.TokenDecoder = (*Decoder)(nil)
+
+// New returns new Decoder. JWK Set, if defined, is loaded immediately.
+func New(optFunc ...func(*Option)) (*Decoder, error) {
+	d := Decoder{
+		cfg: Option{
+			refresh: DefaultJWKSRefresh,
+			skew:    DefaultClockSkew,
+			mapper:  DefaultClaimsMapper,
+			now:     time.Now,
+		},
+	}
+
+	for i := range optFunc {
+		optFunc[i](&d.cfg)
+	}
+
+	if len(d.cfg.keyErrors) > 0 {
+		return nil, d.cfg.keyErrors[0]
+	}
+
+	switch {
+	case d.cfg.jwksFile != "" && d.cfg.jwksURL != "":
+		return nil, fmt.Errorf("jwt: JWKS file and URL are mutually exclusive")
+	case d.cfg.jwksFile != "":
+		d.cfg.source = fileSource(d.cfg.jwksFile)
+	case d.cfg.jwksURL != "":
+		if d.cfg.client == nil {
+			d.cfg.client = &http.Client{Timeout: 10 * time.Second}
+		}
+		d.cfg.source = urlSource(d.cfg.client, d.cfg.jwksURL)
+	}
+
+	if d.cfg.source == nil && len(d.cfg.keys) == 0 {
+		return nil, fmt.Errorf("jwt: no verification keys defined")
+	}
+
+	if d.cfg.source != nil {
+		d.loadedAt = d.cfg.now()
+		if err := d.loadKeys(); err != nil {
+			return nil, err
+		}
+	}
+	return &d, nil
+}
+
+// Reload reloads JWK Set immediately.
+func (d *Decoder) Reload() error {
+	if d.cfg.source == nil {
+		return nil
+	}
+
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	d.mu.Lock()
+	d.loadedAt = d.cfg.now()
+	d.mu.Unlock()
+
+	return d.loadKeys()
+}
+
+type header struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid"`
+	Typ  string   `json:"typ"`
+	Crit []string `json:"crit"`
+}
+
+// Decode implements vatel.TokenDecoder interface. Verifies signature and
+// claims exp, nbf, iat, aud, iss of encodedToken.
+func (d *Decoder) Decode(encodedToken []byte) (vatel.Tokener, error) {
+
+	if len(encodedToken) > maxTokenSize {
+		return nil, unauthorized(CodeTokenMalformed, "token is too large")
+	}
+
+	parts := bytes.Split(encodedToken, []byte{'.'})
+	if len(parts) != 3 {
+		return nil, unauthorized(CodeTokenMalformed, "token is malformed")
+	}
+
+	var h header
+	if err := decodeJSONSegment(parts[0], &h, false); err != nil {
+		return nil, unauthorized(CodeTokenMalformed, "token header is malformed")
+	}
+	if len(h.Crit) > 0 {
+		return nil, unauthorized(CodeTokenMalformed, "token has unsupported critical headers")
+	}
+	if _, ok := algorithms[h.Alg]; !ok || d.cfg.algs != nil && !d.cfg.algs[h.Alg] {
+		return nil, unauthorized(CodeSignatureInvalid, "token signature algorithm is not accepted").Set("alg", h.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(string(parts[2]))
+	if err != nil {
+		return nil, unauthorized(CodeTokenMalformed, "token signature is malformed")
+	}
+
+	// stale keys are used while they are reloaded, and if reloading fails.
+	d.refreshStaleKeys()
+
+	keys := d.findKeys(h.Kid, h.Alg)
+	if len(keys) == 0 && d.reloadKeys(true) == nil {
+		keys = d.findKeys(h.Kid, h.Alg)
+	}
+	if len(keys) == 0 {
+		return nil, unauthorized(CodeSignatureInvalid, "token signing key not found").Set("kid", h.Kid)
+	}
+
+	signed := encodedToken[:len(parts[0])+1+len(parts[1])]
+	verified := false
+	for i := range keys {
+		if verify(h.Alg, keys[i].public, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, unauthorized(CodeSignatureInvalid, "token signature is invalid")
+	}
+
+	var c Claims
+	if err := decodeJSONSegment(parts[1], &c, true); err != nil || c == nil {
+		return nil, unauthorized(CodeTokenMalformed, "token claims are malformed")
+	}
+
+	if err := d.validate(c); err != nil {
+		return nil, err
+	}
+
+	p, err := d.cfg.mapper(c)
+	if err != nil {
+		return nil, errors.Catch(err).Code(CodeClaimsInvalid).StatusCode(401).Msg("token claims are invalid")
+	}
+
+	return &Token{claims: c, payload: p}, nil
+}
+
+func decodeJSONSegment(seg []byte, dst interface{}, useNumber bool) error {
+	buf := make([]byte, base64.RawURLEncoding.DecodedLen(len(seg)))
+	n, err := base64.RawURLEncoding.Decode(buf, seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf[:n]))
+	if useNumber {
+		dec.UseNumber()
+	}
+	return dec.Decode(dst)
+}
+
+// validate checks registered claims.
+func (d *Decoder) validate(c Claims) error {
+
+	now := d.cfg.now()
+
+	exp, ok, err := c.Time("exp")
+	if err != nil || !ok {
+		return unauthorized(CodeClaimsInvalid, "token claim exp is missed or invalid")
+	}
+	if !now.Before(exp.Add(d.cfg.skew)) {
+		return unauthorized(CodeTokenExpired, "token expired")
+	}
+
+	nbf, ok, err := c.Time("nbf")
+	if err != nil {
+		return unauthorized(CodeClaimsInvalid, "token claim nbf is invalid")
+	}
+	if ok && now.Add(d.cfg.skew).Before(nbf) {
+		return unauthorized(CodeTokenNotActive, "token is not active yet")
+	}
+
+	iat, ok, err := c.Time("iat")
+	if err != nil {
+		return unauthorized(CodeClaimsInvalid, "token claim iat is invalid")
+	}
+	if ok && now.Add(d.cfg.skew).Before(iat) {
+		return unauthorized(CodeClaimsInvalid, "token issued in the future")
+	}
+
+	if d.cfg.issuer != "" && c.String("iss") != d.cfg.issuer {
+		return unauthorized(CodeClaimsInvalid, "token issuer is not accepted").Set("iss", c.String("iss"))
+	}
+
+	if len(d.cfg.audience) > 0 && !c.hasAudience(d.cfg.audience) {
+		return unauthorized(CodeClaimsInvalid, "token audience is not accepted")
+	}
+	return nil
+}
+
+type algorithm struct {
+	hash crypto.Hash
+	kind string
+}
+
+var algorithms = map[string]algorithm{
+	"HS256": {crypto.SHA256, "HS"},
+	"HS384": {crypto.SHA384, "HS"},
+	"HS512": {crypto.SHA512, "HS"},
+	"RS256": {crypto.SHA256, "RS"},
+	"RS384": {crypto.SHA384, "RS"},
+	"RS512": {crypto.SHA512, "RS"},
+	"PS256": {crypto.SHA256, "PS"},
+	"PS384": {crypto.SHA384, "PS"},
+	"PS512": {crypto.SHA512, "PS"},
+	"ES256": {crypto.SHA256, "ES"},
+	"ES384": {crypto.SHA384, "ES"},
+	"ES512": {crypto.SHA512, "ES"},
+	"EdDSA": {0, "EdDSA"},
+}
+
+// ecCurves holds curves required by ES algorithms (RFC 7518, 3.4).
+var ecCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+// isKeyCompatible returns true if key k can be used with algorithm alg.
+// It prevents using of public keys as HMAC secrets.
+func isKeyCompatible(alg string, k interface{}) bool {
+	switch algorithms[alg].kind {
+	case "HS":
+		b, ok := k.([]byte)
+		return ok && len(b) > 0
+	case "RS", "PS":
+		pk, ok := k.(*rsa.PublicKey)
+		return ok && pk.N.BitLen() >= minRSAKeyBits
+	case "ES":
+		pk, ok := k.(*ecdsa.PublicKey)
+		return ok && pk.Curve == ecCurves[alg]
+	case "EdDSA":
+		pk, ok := k.(ed25519.PublicKey)
+		return ok && len(pk) == ed25519.PublicKeySize
+	}
+	return false
+}
+
+// verify returns true if sig is valid signature of signed by key k.
+func verify(alg string, k interface{}, signed, sig []byte) bool {
+
+	a := algorithms[alg]
+	if a.kind == "EdDSA" {
+		return ed25519.Verify(k.(ed25519.PublicKey), signed, sig)
+	}
+
+	if a.kind == "HS" {
+		m := hmac.New(a.hash.New, k.([]byte))
+		m.Write(signed)
+		return hmac.Equal(m.Sum(nil), sig)
+	}
+
+	h := a.hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch a.kind {
+	case "RS":
+		return rsa.VerifyPKCS1v15(k.(*rsa.PublicKey), a.hash, digest, sig) == nil
+	case "PS":
+		return rsa.VerifyPSS(k.(*rsa.PublicKey), a.hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}) == nil
+	case "ES":
+		pk := k.(*ecdsa.PublicKey)
+		size := (pk.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pk, digest, r, s)
+	}
+	return false
+}
+
+// Claims holds JWT claims. Numbers are json.Number.
+type Claims map[string]interface{}
+
+// String returns value of string claim name. Returns empty string if claim
+// is missed or is not a string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Int returns value of integer claim name.
+func (c Claims) Int(name string) (int64, bool) {
+	switch v := c[name].(type) {
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	case float64:
+		return int64(v), v == math.Trunc(v)
+	}
+	return 0, false
+}
+
+// Bool returns value of boolean claim name.
+func (c Claims) Bool(name string) bool {
+	b, _ := c[name].(bool)
+	return b
+}
+
+// Time returns value of NumericDate claim name (e.g. exp). Returns ok false if
+// claim is missed.
+func (c Claims) Time(name string) (t time.Time, ok bool, err error) {
+	v, ok := c[name]
+	if !ok {
+		return t, false, nil
+	}
+
+	var f float64
+	switch n := v.(type) {
+	case json.Number:
+		f, err = n.Float64()
+	case float64:
+		f = n
+	default:
+		err = fmt.Errorf("claim %s is not a number", name)
+	}
+	if err != nil {
+		return t, true, err
+	}
+
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)), true, nil
+}
+
+// Audience returns value of claim aud what is either a string or an array of strings.
+func (c Claims) Audience() []string {
+	switch v := c["aud"].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for i := range v {
+			if s, ok := v[i].(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+func (c Claims) hasAudience(accepted []string) bool {
+	for _, aud := range c.Audience() {
+		for i := range accepted {
+			if aud == accepted[i] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ClaimsMapper converts validated claims to vatel.TokenPayloader.
+type ClaimsMapper func(c Claims) (vatel.TokenPayloader, error)
+
+// DefaultClaimsMapper returns Payload populated from claims:
+//
+//	sub    user ID (UUID)
+//	login  login name, preferred_username is used if missed
+//	role   role ID (integer)
+//	perms  permissions bitset (standard base64)
+//	extra  any application specific value
+//	debug  request debugging flag (boolean)
+func DefaultClaimsMapper(c Claims) (vatel.TokenPayloader, error) {
+
+	var p Payload
+	var err error
+
+	if sub := c.String("sub"); sub != "" {
+		if p.UserID, err = uuid.Parse(sub); err != nil {
+			return nil, errors.Catch(err).Set("claim", "sub").Msg("invalid claim sub")
+		}
+	}
+
+	if p.LoginName = c.String("login"); p.LoginName == "" {
+		p.LoginName = c.String("preferred_username")
+	}
+
+	if _, ok := c["role"]; ok {
+		role, ok := c.Int("role")
+		if !ok {
+			return nil, errors.New("invalid claim role").Set("claim", "role")
+		}
+		p.RoleID = int(role)
+	}
+
+	if perms := c.String("perms"); perms != "" {
+		if p.PermSet, err = base64.StdEncoding.DecodeString(perms); err != nil {
+			return nil, errors.Catch(err).Set("claim", "perms").Msg("invalid claim perms")
+		}
+	}
+
+	p.ExtraData = c["extra"]
+	p.DebugFlag = c.Bool("debug")
+	return &p, nil
+}
+
+// Payload is the vatel.TokenPayloader returned by DefaultClaimsMapper.
+type Payload struct {
+	UserID    uuid.UUID
+	LoginName string
+	RoleID    int
+	PermSet   []byte
+	ExtraData interface{}
+	DebugFlag bool
+}
+
+var _ vatel.TokenPayloader = (*Payload)(nil)
+
+// User implements vatel.TokenPayloader interface.
+func (p *Payload) User() uuid.UUID { return p.UserID }
+
+// Login implements vatel.TokenPayloader interface.
+func (p *Payload) Login() string { return p.LoginName }
+
+// Role implements vatel.TokenPayloader interface.
+func (p *Payload) Role() int { return p.RoleID }
+
+// Perms implements vatel.TokenPayloader interface.
+func (p *Payload) Perms() []byte { return p.PermSet }
+
+// Extra implements vatel.TokenPayloader interface.
+func (p *Payload) Extra() interface{} { return p.ExtraData }
+
+// Debug implements vatel.TokenPayloader interface.
+func (p *Payload) Debug() bool { return p.DebugFlag }
+
+// Token is the decoded JWT. It implements vatel.Tokener.
+type Token struct {
+	claims  Claims
+	payload vatel.TokenPayloader
+}
+
+var _ vatel.Tokener = (*Token)(nil)
+
+// registeredClaims holds names of claims defined by RFC 7519.
+var registeredClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
+
+// SystemPayload implements vatel.Tokener interface. Returns registered claims
+// (iss, sub, aud, exp, nbf, iat, jti).
+func (t *Token) SystemPayload() map[string]interface{} {
+	res := make(map[string]interface{}, len(registeredClaims))
+	for _, name := range registeredClaims {
+		if v, ok := t.claims[name]; ok {
+			res[name] = v
+		}
+	}
+	return res
+}
+
+// ApplicationPayload implements vatel.Tokener interface.
+func (t *Token) ApplicationPayload() vatel.TokenPayloader {
+	return t.payload
+}
+
+// Claims returns all token claims.
+func (t *Token) Claims() Claims {
+	return t.claims
+}
@@ -0,0 +1,230 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axkit/errors"
+	"github.com/google/uuid"
+)
+
+var testNow = time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func testClock() time.Time { return testNow }
+
+// testSign returns token signed by private key k.
+func testSign(t *testing.T, alg, kid string, k interface{}, claims map[string]interface{}) string {
+	t.Helper()
+
+	h := map[string]interface{}{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		h["kid"] = kid
+	}
+	hb, _ := json.Marshal(h)
+	cb, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(cb)
+
+	a := algorithms[alg]
+	var digest []byte
+	if a.hash != 0 {
+		hh := a.hash.New()
+		hh.Write([]byte(signed))
+		digest = hh.Sum(nil)
+	}
+
+	var sig []byte
+	var err error
+	switch pk := k.(type) {
+	case []byte:
+		m := hmac.New(a.hash.New, pk)
+		m.Write([]byte(signed))
+		sig = m.Sum(nil)
+	case *rsa.PrivateKey:
+		if a.kind == "PS" {
+			sig, err = rsa.SignPSS(rand.Reader, pk, a.hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, pk, a.hash, digest)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, serr := ecdsa.Sign(rand.Reader, pk, digest)
+		size := (pk.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[size-len(rb):size], rb)
+		copy(sig[2*size-len(sb):], sb)
+		err = serr
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(pk, []byte(signed))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func testClaims(mod map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{
+		"iss":   "https://auth.example.com",
+		"aud":   []string{"billing", "crm"},
+		"sub":   "e7d8a1c0-6f3e-4b2a-9c1d-2f4e5a6b7c8d",
+		"login": "john",
+		"role":  2,
+		"perms": base64.StdEncoding.EncodeToString([]byte{0x05, 0x80}),
+		"extra": map[string]interface{}{"tenant": 7},
+		"debug": true,
+		"iat":   testNow.Add(-time.Minute).Unix(),
+		"nbf":   testNow.Add(-time.Minute).Unix(),
+		"exp":   testNow.Add(time.Hour).Unix(),
+	}
+	for k, v := range mod {
+		if v == nil {
+			delete(c, k)
+			continue
+		}
+		c[k] = v
+	}
+	return c
+}
+
+func TestDecoder_algorithms(t *testing.T) {
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ek256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ek384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, edk, _ := ed25519.GenerateKey(rand.Reader)
+
+	d, err := New(WithClock(testClock),
+		WithKey("hs", secret),
+		WithKey("rs", &rk.PublicKey),
+		WithKey("es256", &ek256.PublicKey),
+		WithKey("es384", ek384),
+		WithKey("ed", edk.Public()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		alg string
+		kid string
+		key interface{}
+	}{
+		{"HS256", "hs", secret},
+		{"HS384", "hs", secret},
+		{"HS512", "hs", secret},
+		{"RS256", "rs", rk},
+		{"PS256", "rs", rk},
+		{"ES256", "es256", ek256},
+		{"ES384", "es384", ek384},
+		{"EdDSA", "ed", edk},
+	}
+
+	for _, c := range cases {
+		tok := testSign(t, c.alg, c.kid, c.key, testClaims(nil))
+		res, err := d.Decode([]byte(tok))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.alg, err)
+			continue
+		}
+
+		p := res.ApplicationPayload()
+		if p.User() != uuid.MustParse("e7d8a1c0-6f3e-4b2a-9c1d-2f4e5a6b7c8d") || p.Login() != "john" || p.Role() != 2 ||
+			string(p.Perms()) != "\x05\x80" || !p.Debug() || p.Extra().(map[string]interface{})["tenant"] == nil {
+			t.Errorf("%s: unexpected payload %+v", c.alg, p)
+		}
+		if res.SystemPayload()["iss"] != "https://auth.example.com" || res.SystemPayload()["login"] != nil {
+			t.Errorf("%s: unexpected system payload %v", c.alg, res.SystemPayload())
+		}
+
+		// tampered claims.
+		parts := strings.Split(tok, ".")
+		parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"login":"admin"}`))
+		if _, err := d.Decode([]byte(strings.Join(parts, "."))); err == nil {
+			t.Errorf("%s: tampered token accepted", c.alg)
+		}
+	}
+
+	// key of another type must not be used, i.e. RSA public key as HMAC secret.
+	if _, err := d.Decode([]byte(testSign(t, "HS256", "rs", []byte("x"), testClaims(nil)))); err == nil {
+		t.Error("token signed by incompatible key accepted")
+	}
+
+	// token without kid is verified by all compatible keys, token with kid only by the key with the same id.
+	if _, err := d.Decode([]byte(testSign(t, "RS256", "", rk, testClaims(nil)))); err != nil {
+		t.Errorf("token without kid rejected: %v", err)
+	}
+	if _, err := d.Decode([]byte(testSign(t, "RS256", "es256", rk, testClaims(nil)))); err == nil {
+		t.Error("token verified by key with another kid")
+	}
+
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"exp":9999999999}`)) + "."
+	if _, err := d.Decode([]byte(none)); err == nil {
+		t.Error("algorithm none accepted")
+	}
+
+	d, _ = New(WithClock(testClock), WithKey("", secret), WithAlgorithms("HS512"))
+	if _, err := d.Decode([]byte(testSign(t, "HS256", "", secret, testClaims(nil)))); err == nil {
+		t.Error("not allowed algorithm accepted")
+	}
+}
+
+func TestDecoder_claims(t *testing.T) {
+
+	secret := []byte("secret")
+	d, err := New(WithClock(testClock), WithKey("", secret), WithIssuer("https://auth.example.com"), WithAudience("crm"), WithClockSkew(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		mod  map[string]interface{}
+		code string
+	}{
+		{"valid", nil, ""},
+		{"exp within skew", map[string]interface{}{"exp": testNow.Add(-5 * time.Second).Unix()}, ""},
+		{"expired", map[string]interface{}{"exp": testNow.Add(-11 * time.Second).Unix()}, CodeTokenExpired},
+		{"exp missed", map[string]interface{}{"exp": nil}, CodeClaimsInvalid},
+		{"exp invalid", map[string]interface{}{"exp": "tomorrow"}, CodeClaimsInvalid},
+		{"nbf within skew", map[string]interface{}{"nbf": testNow.Add(5 * time.Second).Unix()}, ""},
+		{"not active", map[string]interface{}{"nbf": testNow.Add(time.Minute).Unix()}, CodeTokenNotActive},
+		{"iat in future", map[string]interface{}{"iat": testNow.Add(time.Minute).Unix()}, CodeClaimsInvalid},
+		{"fractional exp", map[string]interface{}{"exp": float64(testNow.Unix()) + 60.5}, ""},
+		{"issuer", map[string]interface{}{"iss": "https://evil.example.com"}, CodeClaimsInvalid},
+		{"single audience", map[string]interface{}{"aud": "crm"}, ""},
+		{"audience", map[string]interface{}{"aud": "billing"}, CodeClaimsInvalid},
+		{"sub", map[string]interface{}{"sub": "john"}, CodeClaimsInvalid},
+		{"preferred_username", map[string]interface{}{"login": nil, "preferred_username": "john"}, ""},
+	}
+
+	for _, c := range cases {
+		_, err := d.Decode([]byte(testSign(t, "HS256", "", secret, testClaims(c.mod))))
+		if c.code == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		ce, ok := err.(*errors.CatchedError)
+		if !ok || ce.GetCode() != c.code || ce.Last().StatusCode != 401 {
+			t.Errorf("%s: expected error %s with status 401, got %v", c.name, c.code, err)
+		}
+	}
+
+	for _, tok := range []string{"", "a.b", "a.b.c", strings.Repeat("a", maxTokenSize+1)} {
+		if _, err := d.Decode([]byte(tok)); err == nil {
+			t.Errorf("malformed token %.10q accepted", tok)
+		}
+	}
+}
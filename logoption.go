@@ -0,0 +1,60 @@
+package vatel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// logOptionNames holds text names of LogOption flags in the order of bits.
+var logOptionNames = []string{"silent", "enter", "exit", "reqBody", "reqInput", "respBody", "respOutput"}
+
+// String returns comma separated names of flags (e.g. "exit,reqBody").
+func (lo LogOption) String() string {
+	var res []string
+	for i := range logOptionNames {
+		if lo&(1<<uint(i)) != 0 {
+			res = append(res, logOptionNames[i])
+		}
+	}
+	return strings.Join(res, ",")
+}
+
+// parseLogOption parses comma separated names of flags and names of predefined
+// sets "full", "fullOnExit", "confidential". Empty text is not accepted.
+func parseLogOption(text string) (LogOption, error) {
+	var res LogOption
+
+	for _, name := range strings.Split(text, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+			continue
+		case "full":
+			res |= LogFull
+			continue
+		case "fullOnExit":
+			res |= LogFullOnExit
+			continue
+		case "confidential":
+			res |= LogConfidential
+			continue
+		}
+
+		found := false
+		for i := range logOptionNames {
+			if logOptionNames[i] == name {
+				res |= 1 << uint(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown log option %q", name)
+		}
+	}
+
+	if res == 0 {
+		return 0, fmt.Errorf("log options are empty")
+	}
+	return res, nil
+}
@@ -0,0 +1,330 @@
+// Package metrics implements vatel.MetricReporter collecting HTTP request
+// metrics and serving them in Prometheus text exposition format.
+//
+//	mr := metrics.New(metrics.WithNamespace("billing"))
+//	v := vatel.NewVatel(vatel.WithMetricReporter(mr))
+//	v.Add(mr)
+//
+// Metrics are labelled by HTTP method and route template (e.g. /customers/{id}),
+// not by the raw URL, so number of series is limited by number of endpoints.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golangkit/vatel"
+)
+
+var (
+	// DefaultDurationBuckets holds upper bounds of request duration histogram buckets in seconds.
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// DefaultSizeBuckets holds upper bounds of response size histogram buckets in bytes.
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+// Option holds Reporter settings.
+type Option struct {
+	namespace       string
+	path            string
+	durationBuckets []float64
+	sizeBuckets     []float64
+}
+
+// WithNamespace sets prefix of metric names. Default is "vatel".
+func WithNamespace(ns string) func(*Option) {
+	return func(o *Option) {
+		o.namespace = ns
+	}
+}
+
+// WithPath sets path of exposition endpoint. Default is "/metrics".
+func WithPath(path string) func(*Option) {
+	return func(o *Option) {
+		o.path = path
+	}
+}
+
+// WithDurationBuckets sets upper bounds of request duration histogram buckets in seconds.
+func WithDurationBuckets(b ...float64) func(*Option) {
+	return func(o *Option) {
+		o.durationBuckets = b
+	}
+}
+
+// WithSizeBuckets sets upper bounds of response size histogram buckets in bytes.
+func WithSizeBuckets(b ...float64) func(*Option) {
+	return func(o *Option) {
+		o.sizeBuckets = b
+	}
+}
+
+// Reporter collects metrics of HTTP requests. It implements interfaces
+// vatel.MetricReporter, vatel.InFlightReporter and vatel.Endpointer.
+type Reporter struct {
+	cfg Option
+
+	mu     sync.RWMutex
+	series map[route]*series
+}
+
+type route struct {
+	method string
+	path   string
+}
+
+type series struct {
+	mu       sync.Mutex
+	inFlight int64
+	status   map[int]uint64
+	dur      histogram
+	size     histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(bounds []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds))
+	}
+	for i := range bounds {
+		if v <= bounds[i] {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// New returns new Reporter.
+func New(optFunc ...func(*Option)) *Reporter {
+	r := Reporter{
+		cfg: Option{
+			namespace:       "vatel",
+			path:            "/metrics",
+			durationBuckets: DefaultDurationBuckets,
+			sizeBuckets:     DefaultSizeBuckets,
+		},
+		series: make(map[route]*series),
+	}
+
+	for i := range optFunc {
+		optFunc[i](&r.cfg)
+	}
+
+	r.cfg.durationBuckets = sortedBounds(r.cfg.durationBuckets)
+	r.cfg.sizeBuckets = sortedBounds(r.cfg.sizeBuckets)
+	return &r
+}
+
+func sortedBounds(b []float64) []float64 {
+	res := append([]float64{}, b...)
+	sort.Float64s(res)
+	return res
+}
+
+func (r *Reporter) get(method, path string) *series {
+	key := route{method: method, path: path}
+
+	r.mu.RLock()
+	s, ok := r.series[key]
+	r.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok = r.series[key]; !ok {
+		s = &series{status: make(map[int]uint64)}
+		r.series[key] = s
+	}
+	return s
+}
+
+// ReportMetric implements vatel.MetricReporter.
+func (r *Reporter) ReportMetric(method, path string, statusCode int, dur float64, size int) {
+	s := r.get(method, path)
+	s.mu.Lock()
+	s.status[statusCode]++
+	s.dur.observe(r.cfg.durationBuckets, dur)
+	s.size.observe(r.cfg.sizeBuckets, float64(size))
+	s.mu.Unlock()
+}
+
+// RequestStarted implements vatel.InFlightReporter.
+func (r *Reporter) RequestStarted(method, path string) {
+	s := r.get(method, path)
+	s.mu.Lock()
+	s.inFlight++
+	s.mu.Unlock()
+}
+
+// RequestFinished implements vatel.InFlightReporter.
+func (r *Reporter) RequestFinished(method, path string) {
+	s := r.get(method, path)
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+}
+
+// snapshot is a copy of series taken under lock.
+type snapshot struct {
+	route
+	inFlight int64
+	status   map[int]uint64
+	dur      histogram
+	size     histogram
+}
+
+func (r *Reporter) snapshot() []snapshot {
+	r.mu.RLock()
+	res := make([]snapshot, 0, len(r.series))
+	for k, s := range r.series {
+		s.mu.Lock()
+		ss := snapshot{route: k, inFlight: s.inFlight, status: make(map[int]uint64, len(s.status)), dur: s.dur, size: s.size}
+		for code, n := range s.status {
+			ss.status[code] = n
+		}
+		ss.dur.counts = append([]uint64{}, s.dur.counts...)
+		ss.size.counts = append([]uint64{}, s.size.counts...)
+		s.mu.Unlock()
+		res = append(res, ss)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].path == res[j].path {
+			return res[i].method < res[j].method
+		}
+		return res[i].path < res[j].path
+	})
+	return res
+}
+
+// WriteTo writes all metrics to w in Prometheus text exposition format.
+func (r *Reporter) WriteTo(w io.Writer) (int64, error) {
+	cw := countingWriter{w: bufio.NewWriter(w)}
+	ss := r.snapshot()
+	ns := r.cfg.namespace + "_http_"
+
+	cw.header(ns+"requests_total", "counter", "Total number of processed HTTP requests.")
+	for i := range ss {
+		codes := make([]int, 0, len(ss[i].status))
+		for code := range ss[i].status {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			cw.sample(ns+"requests_total", ss[i].labels(`,status="`+strconv.Itoa(code)+`"`), float64(ss[i].status[code]))
+		}
+	}
+
+	cw.header(ns+"requests_in_flight", "gauge", "Number of HTTP requests being processed.")
+	for i := range ss {
+		cw.sample(ns+"requests_in_flight", ss[i].labels(""), float64(ss[i].inFlight))
+	}
+
+	cw.header(ns+"request_duration_seconds", "histogram", "HTTP request processing duration in seconds.")
+	for i := range ss {
+		cw.histogram(ns+"request_duration_seconds", &ss[i], r.cfg.durationBuckets, &ss[i].dur)
+	}
+
+	cw.header(ns+"response_size_bytes", "histogram", "HTTP response body size in bytes.")
+	for i := range ss {
+		cw.histogram(ns+"response_size_bytes", &ss[i], r.cfg.sizeBuckets, &ss[i].size)
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (s *snapshot) labels(extra string) string {
+	return `{method="` + escapeLabel(s.method) + `",path="` + escapeLabel(s.path) + `"` + extra + `}`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) write(s string) {
+	if cw.err != nil {
+		return
+	}
+	n, err := cw.w.WriteString(s)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+func (cw *countingWriter) header(name, typ, help string) {
+	cw.write("# HELP " + name + " " + help + "\n# TYPE " + name + " " + typ + "\n")
+}
+
+func (cw *countingWriter) sample(name, labels string, v float64) {
+	cw.write(name + labels + " " + formatFloat(v) + "\n")
+}
+
+func (cw *countingWriter) histogram(name string, s *snapshot, bounds []float64, h *histogram) {
+	if h.count == 0 {
+		return
+	}
+	for i := range bounds {
+		cw.sample(name+"_bucket", s.labels(`,le="`+formatFloat(bounds[i])+`"`), float64(h.counts[i]))
+	}
+	cw.sample(name+"_bucket", s.labels(`,le="+Inf"`), float64(h.count))
+	cw.sample(name+"_sum", s.labels(""), h.sum)
+	cw.sample(name+"_count", s.labels(""), float64(h.count))
+}
+
+// Endpoints implements vatel.Endpointer. It returns endpoint serving
+// metrics in Prometheus text exposition format.
+func (r *Reporter) Endpoints() []vatel.Endpoint {
+	return []vatel.Endpoint{
+		{
+			Method:     "GET",
+			Path:       r.cfg.path,
+			LogOptions: vatel.LogSilent,
+			Controller: func() vatel.Handler { return &exposition{r: r} },
+		},
+	}
+}
+
+type exposition struct {
+	r *Reporter
+}
+
+// ContentType is the content type of Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+func (c *exposition) Handle(ctx vatel.Context) error {
+	ctx.SetContentType([]byte(ContentType))
+	_, err := c.r.WriteTo(ctx.BodyWriter())
+	return err
+}
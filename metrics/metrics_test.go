@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReporter_WriteTo(t *testing.T) {
+
+	r := New(WithNamespace("test"), WithDurationBuckets(0.1, 1), WithSizeBuckets(1000))
+
+	r.RequestStarted("GET", "/customers/{id}")
+	r.ReportMetric("GET", "/customers/{id}", 200, 0.05, 10)
+	r.ReportMetric("GET", "/customers/{id}", 404, 0.5, 2000)
+	r.RequestStarted("GET", "/customers/{id}")
+	r.RequestFinished("GET", "/customers/{id}")
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(n) != buf.Len() {
+		t.Errorf("expected %d bytes written, got %d", buf.Len(), n)
+	}
+
+	expected := []string{
+		"# TYPE test_http_requests_total counter",
+		`test_http_requests_total{method="GET",path="/customers/{id}",status="200"} 1`,
+		`test_http_requests_total{method="GET",path="/customers/{id}",status="404"} 1`,
+		`test_http_requests_in_flight{method="GET",path="/customers/{id}"} 1`,
+		"# TYPE test_http_request_duration_seconds histogram",
+		`test_http_request_duration_seconds_bucket{method="GET",path="/customers/{id}",le="0.1"} 1`,
+		`test_http_request_duration_seconds_bucket{method="GET",path="/customers/{id}",le="1"} 2`,
+		`test_http_request_duration_seconds_bucket{method="GET",path="/customers/{id}",le="+Inf"} 2`,
+		`test_http_request_duration_seconds_sum{method="GET",path="/customers/{id}"} 0.55`,
+		`test_http_response_size_bytes_bucket{method="GET",path="/customers/{id}",le="1000"} 1`,
+		`test_http_response_size_bytes_count{method="GET",path="/customers/{id}"} 2`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("line %q expected in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if s := escapeLabel("a\"b\\c\nd"); s != `a\"b\\c\nd` {
+		t.Errorf("unexpected result: %s", s)
+	}
+}
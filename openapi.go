@@ -0,0 +1,478 @@
+package vatel
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OpenAPIVersion holds version of OpenAPI specification generated by Vatel.
+const OpenAPIVersion = "3.1.0"
+
+// BearerAuthScheme holds name of the security scheme assigned
+// to endpoints having Perms.
+const BearerAuthScheme = "bearerAuth"
+
+// OpenAPIInfo holds metadata about the API.
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIDocument is the root object of OpenAPI document.
+type OpenAPIDocument struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       OpenAPIInfo         `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components *OpenAPIComponents  `json:"components,omitempty"`
+}
+
+// PathItem holds operations available on a single path. Key is lowercased
+// HTTP method name.
+type PathItem map[string]*Operation
+
+// SecurityRequirement maps security scheme name to the list of permissions
+// required to call an operation.
+type SecurityRequirement map[string][]string
+
+// Operation describes a single API operation on a path.
+type Operation struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []SecurityRequirement `json:"security,omitempty"`
+}
+
+// Parameter describes a single operation parameter taken from URL path or query.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Style    string  `json:"style,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody describes a request body.
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response describes a single response from an API operation.
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds schema of request or response body.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// OpenAPIComponents holds reusable schemas and security schemes.
+type OpenAPIComponents struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme defines a security scheme that can be used by the operations.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// errorSchema returns schema of error response body produced by writeErrorResponse.
+func errorSchema() *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"msg":        {Type: "string"},
+			"severity":   {Type: "string"},
+			"code":       {Type: "string"},
+			"statusCode": {Type: "integer", Format: "int32"},
+		},
+		Required: []string{"msg", "severity"},
+		order:    []string{"msg", "severity", "code", "statusCode"},
+	}
+}
+
+// pathParamRe matches fasthttp router path parameters: {id}, {id?}, {id:[0-9]+}, {filepath:*}.
+var pathParamRe = regexp.MustCompile(`\{([^{}:?]+)[^{}]*\}`)
+
+// pathParams returns names of parameters in the path template.
+func pathParams(path string) []string {
+	var res []string
+	for _, m := range pathParamRe.FindAllStringSubmatch(path, -1) {
+		res = append(res, m[1])
+	}
+	return res
+}
+
+// openAPIPath converts fasthttp router path template to OpenAPI path template.
+func openAPIPath(path string) string {
+	return pathParamRe.ReplaceAllString(path, "{$1}")
+}
+
+// OpenAPI returns OpenAPI 3.1 document describing registered endpoints. The
+// method is expected to be called after BuildHandlers.
+func (v *Vatel) OpenAPI() *OpenAPIDocument {
+
+	doc := OpenAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info:    v.cfg.openAPIInfo,
+		Paths:   make(map[string]PathItem),
+	}
+
+	if doc.Info.Title == "" {
+		doc.Info.Title = "API"
+	}
+	if doc.Info.Version == "" {
+		doc.Info.Version = "0.0.0"
+	}
+
+	sg := newSchemaGenerator(true)
+	secured := false
+
+	for i := range v.ep {
+		e := &v.ep[i]
+		if e.internal {
+			continue
+		}
+
+		p := openAPIPath(e.Path)
+		pi, ok := doc.Paths[p]
+		if !ok {
+			pi = make(PathItem)
+			doc.Paths[p] = pi
+		}
+
+		op := e.openAPIOperation(sg)
+		if len(op.Security) > 0 {
+			secured = true
+		}
+		pi[strings.ToLower(e.Method)] = op
+	}
+
+	doc.Components = &OpenAPIComponents{Schemas: sg.components}
+	doc.Components.Schemas["Error"] = errorSchema()
+
+	if secured {
+		doc.Components.SecuritySchemes = map[string]*SecurityScheme{
+			BearerAuthScheme: {
+				Type:        "http",
+				Scheme:      "bearer",
+				Description: "Security scopes list permissions required by the operation.",
+			},
+		}
+	}
+
+	return &doc
+}
+
+func (e *Endpoint) openAPIOperation(sg *schemaGenerator) *Operation {
+
+	op := Operation{
+		OperationID: operationID(e.Method, e.Path),
+		Responses:   make(map[string]*Response),
+	}
+
+	c := e.Controller()
+
+	var pt reflect.Type
+	if p, ok := c.(Paramer); ok {
+		pt = reflect.TypeOf(p.Param())
+	}
+
+	for _, name := range pathParams(e.Path) {
+		par := Parameter{Name: name, In: "path", Required: true}
+		if f, ok := pathParamField(pt, name); ok {
+			par.Schema = sg.schema(f.Type)
+			par.Schema.Mask = f.Tag.Get("mask")
+			par.Schema.applyValidationRules(f.Tag.Get("validate"))
+		} else {
+			par.Schema = &Schema{Type: "string"}
+		}
+		op.Parameters = append(op.Parameters, &par)
+	}
+
+	if in, ok := c.(Inputer); ok {
+		switch e.Method {
+		case "GET", "DELETE":
+			for _, f := range paramFields(reflect.TypeOf(in.Input())) {
+				par := Parameter{Name: f.Tag.Get("param"), In: "query", Schema: sg.schema(f.Type)}
+				par.Schema.Mask = f.Tag.Get("mask")
+				par.Required = par.Schema.applyValidationRules(f.Tag.Get("validate"))
+				if par.Schema.AdditionalProperties != nil {
+					par.Style = "deepObject"
+				}
+				op.Parameters = append(op.Parameters, &par)
+			}
+		default:
+			if it := reflect.TypeOf(in.Input()); hasFormTags(it) {
+				op.RequestBody = &RequestBody{
+					Required: true,
+					Content:  map[string]*MediaType{"multipart/form-data": {Schema: sg.formSchema(it)}},
+				}
+				break
+			}
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]*MediaType{"application/json": {Schema: sg.schemaOf(in.Input())}},
+			}
+		}
+	}
+
+	success := Response{Description: "Successful response"}
+	if r, ok := c.(Resulter); ok {
+		success.Content = map[string]*MediaType{e.mediaType(): {Schema: sg.schemaOf(r.Result())}}
+	}
+	if _, ok := c.(FileResulter); ok {
+		success.Content = map[string]*MediaType{"application/octet-stream": {Schema: &Schema{Type: "string", Format: "binary"}}}
+	}
+
+	op.Responses[strconv.Itoa(e.statusCodeOnSuccess(c))] = &success
+	op.Responses["default"] = &Response{
+		Description: "Error response",
+		Content:     map[string]*MediaType{"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}}},
+	}
+
+	if len(e.Perms) > 0 {
+		op.Security = []SecurityRequirement{{BearerAuthScheme: append([]string{}, e.Perms...)}}
+	}
+
+	return &op
+}
+
+// mediaType returns endpoint's response media type without parameters.
+func (e *Endpoint) mediaType() string {
+	ct := e.ResponseContentType
+	if ct == "" {
+		return "application/json"
+	}
+	if idx := strings.IndexByte(ct, ';'); idx >= 0 {
+		ct = ct[:idx]
+	}
+	return strings.TrimSpace(ct)
+}
+
+// operationID builds operation identifier like "getCustomersById" from
+// method and path.
+func operationID(method, path string) string {
+	res := strings.ToLower(method)
+	for _, s := range strings.FieldsFunc(openAPIPath(path), func(r rune) bool {
+		return r == '/' || r == '-' || r == '_' || r == '.'
+	}) {
+		if s[0] == '{' {
+			s = "By" + strings.Trim(s, "{}")
+		}
+		res += strings.ToUpper(s[:1]) + s[1:]
+	}
+	return res
+}
+
+// paramFields returns struct fields having tag "param". Fields of nested
+// structs without tag "param" are included as well.
+func paramFields(t reflect.Type) []reflect.StructField {
+	return taggedFields(t, "param")
+}
+
+// taggedFields returns fields of struct t having tag, including fields of nested structs.
+func taggedFields(t reflect.Type, tag string) []reflect.StructField {
+	var res []reflect.StructField
+
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		if f.Tag.Get(tag) != "" {
+			res = append(res, f)
+			continue
+		}
+
+		if f.Type.Kind() == reflect.Struct {
+			res = append(res, taggedFields(f.Type, tag)...)
+		}
+	}
+	return res
+}
+
+// pathParamField returns the field receiving path parameter name. If type t is
+// not a struct, it receives the only path parameter and is returned as a field.
+func pathParamField(t reflect.Type, name string) (reflect.StructField, bool) {
+	if t != nil && t.Kind() == reflect.Ptr {
+		if et := t.Elem(); et.Kind() != reflect.Struct || isDecodableType(et) {
+			return reflect.StructField{Name: name, Type: et}, true
+		}
+	}
+	return paramField(t, name)
+}
+
+// paramField looks for the field with tag param equal to name.
+func paramField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for _, f := range paramFields(t) {
+		if f.Tag.Get("param") == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// MarshalYAML returns the document in YAML format.
+func (doc *OpenAPIDocument) MarshalYAML() ([]byte, error) {
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return jsonToYAML(buf)
+}
+
+// jsonToYAML converts JSON document to YAML keeping attributes order.
+// Strings are written as double quoted scalars which are valid YAML.
+func jsonToYAML(src []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+
+	var res bytes.Buffer
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeYAMLValue(&res, dec, tok, 0, yamlNewLine); err != nil {
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+// yamlPos describes where a YAML value starts.
+type yamlPos int
+
+const (
+	yamlNewLine   yamlPos = iota // value starts on a new line.
+	yamlAfterKey                 // value continues the line "key:".
+	yamlAfterDash                // value continues the line "- ".
+)
+
+// writeYAMLValue writes the value started with the token tok.
+func writeYAMLValue(w *bytes.Buffer, dec *json.Decoder, tok json.Token, indent int, pos yamlPos) error {
+
+	if d, ok := tok.(json.Delim); ok {
+		if d == '{' {
+			return writeYAMLObject(w, dec, indent, pos)
+		}
+		return writeYAMLArray(w, dec, indent, pos)
+	}
+
+	if pos == yamlAfterKey {
+		w.WriteByte(' ')
+	}
+
+	switch t := tok.(type) {
+	case string:
+		qs, _ := json.Marshal(t)
+		w.Write(qs)
+	case json.Number:
+		w.WriteString(t.String())
+	case bool:
+		w.WriteString(strconv.FormatBool(t))
+	case nil:
+		w.WriteString("null")
+	}
+	w.WriteByte('\n')
+	return nil
+}
+
+var yamlPlainKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+func writeYAMLObject(w *bytes.Buffer, dec *json.Decoder, indent int, pos yamlPos) error {
+
+	if !dec.More() {
+		if pos == yamlAfterKey {
+			w.WriteByte(' ')
+		}
+		w.WriteString("{}\n")
+		_, err := dec.Token()
+		return err
+	}
+
+	if pos == yamlAfterKey {
+		w.WriteByte('\n')
+	}
+
+	for first := true; dec.More(); first = false {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+
+		if !(first && pos == yamlAfterDash) {
+			w.WriteString(strings.Repeat("  ", indent))
+		}
+
+		if yamlPlainKeyRe.MatchString(key) {
+			w.WriteString(key)
+		} else {
+			qk, _ := json.Marshal(key)
+			w.Write(qk)
+		}
+		w.WriteByte(':')
+
+		if tok, err = dec.Token(); err != nil {
+			return err
+		}
+		if err := writeYAMLValue(w, dec, tok, indent+1, yamlAfterKey); err != nil {
+			return err
+		}
+	}
+
+	_, err := dec.Token() // closing '}'
+	return err
+}
+
+func writeYAMLArray(w *bytes.Buffer, dec *json.Decoder, indent int, pos yamlPos) error {
+
+	if !dec.More() {
+		if pos == yamlAfterKey {
+			w.WriteByte(' ')
+		}
+		w.WriteString("[]\n")
+		_, err := dec.Token()
+		return err
+	}
+
+	if pos != yamlNewLine {
+		w.WriteByte('\n')
+	}
+
+	for dec.More() {
+		w.WriteString(strings.Repeat("  ", indent))
+		w.WriteString("- ")
+
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := writeYAMLValue(w, dec, tok, indent+1, yamlAfterDash); err != nil {
+			return err
+		}
+	}
+
+	_, err := dec.Token() // closing ']'
+	return err
+}
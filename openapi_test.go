@@ -0,0 +1,123 @@
+package vatel
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/rs/zerolog"
+)
+
+type testCustomer struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email" mask:"email"`
+	Tags  []string
+	Skip  string `json:"-"`
+}
+
+type testCustomerController struct {
+	param struct {
+		ID int `param:"id"`
+	}
+	res testCustomer
+}
+
+func (c *testCustomerController) Param() interface{}   { return &c.param }
+func (c *testCustomerController) Result() interface{}  { return &c.res }
+func (c *testCustomerController) Handle(Context) error { return nil }
+
+type testSearchController struct {
+	in struct {
+		Name  string `param:"name"`
+		Limit int    `param:"limit"`
+	}
+	res []testCustomer
+}
+
+func (c *testSearchController) Input() interface{}   { return &c.in }
+func (c *testSearchController) Result() interface{}  { return &c.res }
+func (c *testSearchController) Handle(Context) error { return nil }
+
+func TestVatel_OpenAPI(t *testing.T) {
+
+	v := NewVatel(WithOpenAPI("/openapi", OpenAPIInfo{Title: "test", Version: "1.0"}))
+	v.DisableAuthorizer()
+	v.Add(endpoints{
+		{Method: "GET", Path: "/customers/{id}", Controller: func() Handler { return &testCustomerController{} }},
+		{Method: "GET", Path: "/customers", Controller: func() Handler { return &testSearchController{} }},
+	})
+
+	l := zerolog.Nop()
+	if err := v.BuildHandlers(router.New(), &l); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := v.OpenAPI()
+	if len(doc.Paths) != 2 {
+		t.Fatalf("expected 2 paths, got %d", len(doc.Paths))
+	}
+
+	op := doc.Paths["/customers/{id}"]["get"]
+	if op == nil || len(op.Parameters) != 1 || op.Parameters[0].In != "path" || op.Parameters[0].Schema.Type != "integer" {
+		t.Fatalf("unexpected path parameters: %+v", op)
+	}
+
+	cs := doc.Components.Schemas["testCustomer"]
+	if cs == nil {
+		t.Fatal("component testCustomer expected")
+	}
+	if _, ok := cs.Properties["Skip"]; ok {
+		t.Error("field with json:\"-\" must be skipped")
+	}
+	if cs.Properties["email"].Mask != "email" {
+		t.Error("mask tag expected in x-mask")
+	}
+
+	op = doc.Paths["/customers"]["get"]
+	if len(op.Parameters) != 2 || op.Parameters[0].In != "query" || op.Parameters[1].Name != "limit" {
+		t.Fatalf("unexpected query parameters: %+v", op.Parameters)
+	}
+
+	if rs := op.Responses["200"].Content["application/json"].Schema; rs.Type != "array" || rs.Items.Ref != "#/components/schemas/testCustomer" {
+		t.Errorf("unexpected result schema: %+v", rs)
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// modification of a document does not affect other documents.
+	doc.Components.Schemas["Error"].Properties["msg"].Description = "changed"
+	if v.OpenAPI().Components.Schemas["Error"].Properties["msg"].Description != "" {
+		t.Error("schema Error must not be shared by documents")
+	}
+}
+
+type endpoints []Endpoint
+
+func (e endpoints) Endpoints() []Endpoint {
+	return e
+}
+
+func TestJsonToYAML(t *testing.T) {
+	src := `{"a":1,"b":{"c":"x","d":[1,{"e":true,"f":null}],"g":{}},"$ref":[]}`
+	expected := `a: 1
+b:
+  c: "x"
+  d:
+    - 1
+    - e: true
+      f: null
+  g: {}
+"$ref": []
+`
+	res, err := jsonToYAML([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, strings.TrimSpace(string(res)))
+	}
+}
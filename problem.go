@@ -0,0 +1,91 @@
+package vatel
+
+import (
+	"encoding/json"
+
+	"github.com/axkit/errors"
+)
+
+// ProblemDetails is the error response in the format of RFC 7807.
+type ProblemDetails struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Extensions are written as additional members of the problem document.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON implements json.Marshaler. Extensions are merged with standard members.
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+
+	type problem ProblemDetails
+	buf, err := json.Marshal(problem(p))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// Write writes problem document as response with content type application/problem+json.
+func (p *ProblemDetails) Write(ctx Context) error {
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	ctx.SetStatusCode(p.Status).
+		SetContentType([]byte("application/problem+json")).
+		SetBody(buf)
+	return nil
+}
+
+// ProblemResponse returns OnErrorResponse middleware what rewrites error
+// responses to RFC 7807 problem documents. Function f maps error to the problem,
+// if f returns nil the default problem is built from error's message and status code.
+//
+//	v.AddMiddleware(vatel.OnErrorResponse, vatel.ProblemResponse(func(err error) *vatel.ProblemDetails {
+//		if errors.Is(err, ErrInsufficientFunds) {
+//			return &vatel.ProblemDetails{Type: "https://example.com/probs/out-of-credit", Title: "Not enough credit", Status: 403}
+//		}
+//		return nil
+//	}))
+func ProblemResponse(f func(err error) *ProblemDetails) func(Context) error {
+	return func(ctx Context) error {
+		err := ctx.ResponseError()
+		if err == nil {
+			return nil
+		}
+
+		var p *ProblemDetails
+		if f != nil {
+			p = f(err)
+		}
+
+		if p == nil {
+			p = &ProblemDetails{Title: err.Error(), Status: ctx.RequestCtx().Response.StatusCode()}
+			if ce, ok := err.(*errors.CatchedError); ok {
+				p.Title = ce.Last().Message
+				if code := ce.GetCode(); code != "" {
+					p.Extensions = map[string]interface{}{"code": code}
+				}
+			}
+		}
+
+		if p.Status == 0 {
+			p.Status = ctx.RequestCtx().Response.StatusCode()
+		}
+		if p.Instance == "" {
+			p.Instance = string(ctx.RequestCtx().Path())
+		}
+		return p.Write(ctx)
+	}
+}
@@ -0,0 +1,196 @@
+package vatel
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	realip "github.com/Ferluci/fast-realip"
+	"github.com/axkit/errors"
+	"github.com/valyala/fasthttp"
+)
+
+// RateLimitKey defines what requests share the same rate limit.
+type RateLimitKey int
+
+const (
+	// RateLimitByIP limits requests of the client IP address. It is checked
+	// before authorization, so requests with invalid tokens are limited too.
+	RateLimitByIP RateLimitKey = iota
+
+	// RateLimitByUser limits requests of the user taken from access token.
+	// Requests without token are limited by client IP address.
+	RateLimitByUser
+
+	// RateLimitByRole limits requests of all users having the same role.
+	// Requests without token are limited by client IP address.
+	RateLimitByRole
+)
+
+// RateLimit describes rate limit of the endpoint. It's implemented as token bucket:
+// the bucket holds up to Burst tokens and is refilled with Requests tokens per Window.
+// Every request takes one token.
+type RateLimit struct {
+	// Requests is the number of requests allowed per Window.
+	Requests int
+
+	// Window is the period of time.
+	Window time.Duration
+
+	// Burst is the max number of requests allowed at once. Default is Requests.
+	Burst int
+
+	// Key defines what requests share the limit.
+	Key RateLimitKey
+}
+
+// capacity returns size of token bucket.
+func (rl *RateLimit) capacity() int {
+	if rl.Burst > 0 {
+		return rl.Burst
+	}
+	return rl.Requests
+}
+
+// RateLimitResult holds result of the rate limit check.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// RetryAfter is the time when the next request will be allowed. Zero if Allowed.
+	RetryAfter time.Duration
+
+	// Reset is the time when the limit is fully restored.
+	Reset time.Duration
+}
+
+// RateLimitStore is the interface what wraps a single method Allow.
+//
+// Allow takes one token from the bucket identified by key and returns
+// the result of the check.
+type RateLimitStore interface {
+	Allow(key string, rl *RateLimit) (RateLimitResult, error)
+}
+
+// SetRateLimitStore assigns storage of rate limit buckets. If store is not
+// assigned, endpoints having RateLimit use in-memory storage.
+func (v *Vatel) SetRateLimitStore(s RateLimitStore) {
+	v.rls = s
+}
+
+// MemoryRateLimitStore implements RateLimitStore keeping token buckets in memory.
+type MemoryRateLimitStore struct {
+	mu          sync.Mutex
+	buckets     map[string]*tokenBucket
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// NewMemoryRateLimitStore returns new in-memory storage of rate limit buckets.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+// memoryRateLimitCleanupPeriod defines how often full buckets are removed from memory.
+const memoryRateLimitCleanupPeriod = time.Minute
+
+// Allow implements RateLimitStore.
+func (s *MemoryRateLimitStore) Allow(key string, rl *RateLimit) (RateLimitResult, error) {
+
+	capacity := float64(rl.capacity())
+	rate := float64(rl.Requests) / rl.Window.Seconds() // tokens per second
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastCleanup) > memoryRateLimitCleanupPeriod {
+		for k, b := range s.buckets {
+			if now.After(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastCleanup = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := RateLimitResult{Limit: int(capacity)}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = secondsToDuration((capacity - b.tokens) / rate)
+	b.full = now.Add(res.Reset)
+	return res, nil
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// rateLimitKey returns key of token bucket of the request.
+func (e *Endpoint) rateLimitKey(fctx *fasthttp.RequestCtx, tp TokenPayloader) string {
+	prefix := e.Method + " " + e.Path + " "
+	if tp != nil {
+		switch e.RateLimit.Key {
+		case RateLimitByUser:
+			return prefix + "user:" + tp.User().String() + ":" + tp.Login()
+		case RateLimitByRole:
+			return prefix + "role:" + strconv.Itoa(tp.Role())
+		}
+	}
+	return prefix + "ip:" + realip.FromRequest(fctx)
+}
+
+// checkRateLimit takes a token from request's bucket and writes X-RateLimit-* headers.
+// Returns error with status code 429 if the limit is exceeded.
+func (e *Endpoint) checkRateLimit(ctx Context, tp TokenPayloader) error {
+
+	res, err := e.rls.Allow(e.rateLimitKey(ctx.RequestCtx(), tp), e.RateLimit)
+	if err != nil {
+		return errors.Catch(err).StatusCode(500).Msg("rate limit check failed")
+	}
+
+	ctx.SetHeader([]byte("X-RateLimit-Limit"), []byte(strconv.Itoa(res.Limit)))
+	ctx.SetHeader([]byte("X-RateLimit-Remaining"), []byte(strconv.Itoa(res.Remaining)))
+	ctx.SetHeader([]byte("X-RateLimit-Reset"), []byte(strconv.Itoa(ceilSeconds(res.Reset))))
+
+	if res.Allowed {
+		return nil
+	}
+
+	return newTooManyRequestsError(ceilSeconds(res.RetryAfter))
+}
+
+// newTooManyRequestsError returns new error equal to ErrTooManyRequests with
+// Retry-After seconds.
+func newTooManyRequestsError(retryAfter int) error {
+	return errors.New("too many requests").Code("VTL-0008").StatusCode(429).Set("Retry-After", retryAfter)
+}
+
+// ErrTooManyRequests is returned when endpoint's rate limit is exceeded.
+var ErrTooManyRequests = errors.New("too many requests").Code("VTL-0008").StatusCode(429)
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
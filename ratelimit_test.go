@@ -0,0 +1,139 @@
+package vatel
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+
+	now := time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)
+	s := NewMemoryRateLimitStore()
+	s.now = func() time.Time { return now }
+
+	rl := RateLimit{Requests: 2, Window: time.Second, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		if res, _ := s.Allow("k", &rl); !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("request %d: unexpected result %+v", i, res)
+		}
+	}
+
+	res, _ := s.Allow("k", &rl)
+	if res.Allowed || res.RetryAfter != 500*time.Millisecond || res.Reset != 1500*time.Millisecond {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	if res, _ := s.Allow("other", &rl); !res.Allowed {
+		t.Fatal("other key must not be limited")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if res, _ := s.Allow("k", &rl); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("unexpected result after refill %+v", res)
+	}
+
+	now = now.Add(2 * memoryRateLimitCleanupPeriod)
+	s.Allow("k", &rl)
+	if len(s.buckets) != 1 {
+		t.Errorf("full buckets expected to be removed, got %d", len(s.buckets))
+	}
+}
+
+func TestEndpoint_RateLimit(t *testing.T) {
+
+	v := newTestVatel()
+	e := Endpoint{Method: "GET", Path: "/limited", Perms: []string{"Any"}, RateLimit: &RateLimit{Requests: 1, Window: time.Minute, Key: RateLimitByUser},
+		Controller: func() Handler { return &testNopController{} }}
+	if err := e.compile(v); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	h := e.handler(&l)
+
+	request := func(login string) *fasthttp.RequestCtx {
+		var fctx fasthttp.RequestCtx
+		fctx.Request.Header.Set("Authorization", login)
+		h(&fctx)
+		return &fctx
+	}
+
+	if fctx := request("john"); fctx.Response.StatusCode() != 204 || string(fctx.Response.Header.Peek("X-RateLimit-Remaining")) != "0" {
+		t.Fatalf("unexpected response: %d %s", fctx.Response.StatusCode(), fctx.Response.Header.String())
+	}
+
+	fctx := request("john")
+	if fctx.Response.StatusCode() != 429 || string(fctx.Response.Header.Peek("Retry-After")) != "60" {
+		t.Fatalf("unexpected response: %d %s", fctx.Response.StatusCode(), fctx.Response.Header.String())
+	}
+	if !strings.Contains(string(fctx.Response.Body()), "VTL-0008") {
+		t.Errorf("error code expected: %s", fctx.Response.Body())
+	}
+	if _, ok := ErrTooManyRequests.Get("Retry-After"); ok {
+		t.Error("Retry-After must not be set to ErrTooManyRequests")
+	}
+
+	if fctx := request("mary"); fctx.Response.StatusCode() != 204 {
+		t.Fatalf("another user must not be limited: %d", fctx.Response.StatusCode())
+	}
+
+	e = Endpoint{Method: "GET", Path: "/invalid", RateLimit: &RateLimit{Requests: 1}, Controller: func() Handler { return &testNopController{} }}
+	if err := e.compile(v); err == nil {
+		t.Error("error expected for zero Window")
+	}
+}
+
+func TestEndpoint_RateLimitReplay(t *testing.T) {
+
+	calls := 0
+	v := newTestVatel()
+	e := Endpoint{Method: "POST", Path: "/payments", Perms: []string{"Pay"}, Idempotent: true,
+		RateLimit:  &RateLimit{Requests: 5, Window: time.Minute, Key: RateLimitByUser},
+		Controller: func() Handler { return &testPaymentController{calls: &calls} }}
+	if err := e.compile(v); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	h := e.handler(&l)
+
+	// replayed response has actual rate limit headers.
+	for i, remaining := range []string{"4", "3"} {
+		var fctx fasthttp.RequestCtx
+		fctx.Request.SetRequestURI("/payments")
+		fctx.Request.Header.Set("Authorization", "john")
+		fctx.Request.Header.Set(IdempotencyKeyHeader, "k1")
+		fctx.Request.SetBody([]byte(`{"amount":10}`))
+		h(&fctx)
+		if calls != 1 || string(fctx.Response.Header.Peek("X-RateLimit-Remaining")) != remaining {
+			t.Errorf("request %d: expected remaining %s, calls 1, got %s", i, remaining, fctx.Response.Header.String())
+		}
+	}
+}
+
+func TestEndpoint_RateLimitByIPBeforeAuth(t *testing.T) {
+
+	v := newTestVatel()
+	e := Endpoint{Method: "GET", Path: "/limited", Perms: []string{"Any"}, RateLimit: &RateLimit{Requests: 1, Window: time.Minute},
+		Controller: func() Handler { return &testNopController{} }}
+	if err := e.compile(v); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	h := e.handler(&l)
+
+	// failed authorization consumes the limit.
+	for _, status := range []int{401, 429} {
+		var fctx fasthttp.RequestCtx
+		h(&fctx)
+		if fctx.Response.StatusCode() != status {
+			t.Errorf("expected %d, got %d", status, fctx.Response.StatusCode())
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package vatel
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/axkit/errors"
+	"github.com/google/uuid"
+)
+
+// DefaultRefreshTokenTTL is the default lifetime of refresh tokens.
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired").Code("VTL-0020").StatusCode(401)
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected").Code("VTL-0021").StatusCode(401).Critical()
+)
+
+// RefreshToken describes issued refresh token. The token itself is not stored,
+// ID is the hash of the token.
+type RefreshToken struct {
+	ID string
+
+	// Family is the ID of the first token in the chain of rotated tokens.
+	// All tokens of the family are revoked if reuse of a rotated token is detected.
+	Family string
+
+	User      uuid.UUID
+	ExpiresAt time.Time
+}
+
+// RefreshTokenStore is the interface what wraps methods of refresh tokens storage.
+//
+// Save stores new refresh token.
+//
+// Use marks the token as used and returns it. Returns found false if the token
+// is unknown, expired or revoked. Returns used true if the token was used
+// before. Concurrent calls with the same id must return used false only once.
+//
+// RevokeFamily revokes all tokens of the family.
+type RefreshTokenStore interface {
+	Save(rt RefreshToken) error
+	Use(id string) (rt RefreshToken, found, used bool, err error)
+	RevokeFamily(family string) error
+}
+
+// newRefreshToken returns random refresh token and its ID.
+func newRefreshToken() (token, id string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, refreshTokenID(token), nil
+}
+
+// refreshTokenID returns ID of refresh token.
+func refreshTokenID(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// MemoryRefreshTokenStore implements RefreshTokenStore keeping tokens in memory.
+// Used tokens are kept until expiration to detect their reuse.
+type MemoryRefreshTokenStore struct {
+	mu          sync.Mutex
+	tokens      map[string]*refreshEntry
+	revoked     map[string]time.Time
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+type refreshEntry struct {
+	rt   RefreshToken
+	used bool
+}
+
+// memoryRefreshCleanupPeriod defines how often expired tokens are removed from memory.
+const memoryRefreshCleanupPeriod = time.Minute
+
+// NewMemoryRefreshTokenStore returns new in-memory storage of refresh tokens.
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{
+		tokens:  make(map[string]*refreshEntry),
+		revoked: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Save implements RefreshTokenStore.
+func (s *MemoryRefreshTokenStore) Save(rt RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastCleanup) > memoryRefreshCleanupPeriod {
+		for id, e := range s.tokens {
+			if now.After(e.rt.ExpiresAt) {
+				delete(s.tokens, id)
+			}
+		}
+		for f, exp := range s.revoked {
+			if now.After(exp) {
+				delete(s.revoked, f)
+			}
+		}
+		s.lastCleanup = now
+	}
+
+	s.tokens[rt.ID] = &refreshEntry{rt: rt}
+	return nil
+}
+
+// Use implements RefreshTokenStore.
+func (s *MemoryRefreshTokenStore) Use(id string) (RefreshToken, bool, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.tokens[id]
+	if !ok || s.now().After(e.rt.ExpiresAt) {
+		return RefreshToken{}, false, false, nil
+	}
+	if _, ok := s.revoked[e.rt.Family]; ok {
+		return e.rt, false, false, nil
+	}
+
+	used := e.used
+	e.used = true
+	return e.rt, true, used, nil
+}
+
+// RevokeFamily implements RefreshTokenStore.
+func (s *MemoryRefreshTokenStore) RevokeFamily(family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the family is kept until the latest of its tokens expires.
+	exp := s.now()
+	for _, e := range s.tokens {
+		if e.rt.Family == family && e.rt.ExpiresAt.After(exp) {
+			exp = e.rt.ExpiresAt
+		}
+	}
+	s.revoked[family] = exp
+	return nil
+}
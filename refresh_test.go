@@ -0,0 +1,61 @@
+package vatel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMemoryRefreshTokenStore(t *testing.T) {
+
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryRefreshTokenStore()
+	s.now = func() time.Time { return now }
+
+	user := uuid.New()
+	s.Save(RefreshToken{ID: "a", Family: "a", User: user, ExpiresAt: now.Add(time.Hour)})
+	s.Save(RefreshToken{ID: "b", Family: "a", User: user, ExpiresAt: now.Add(2 * time.Hour)})
+	s.Save(RefreshToken{ID: "c", Family: "c", User: user, ExpiresAt: now.Add(time.Minute)})
+
+	if rt, found, used, _ := s.Use("a"); !found || used || rt.User != user {
+		t.Errorf("unused token expected, got found %t, used %t", found, used)
+	}
+	if _, found, used, _ := s.Use("a"); !found || !used {
+		t.Errorf("used token expected, got found %t, used %t", found, used)
+	}
+	if _, found, _, _ := s.Use("x"); found {
+		t.Error("unknown token found")
+	}
+
+	// reuse revokes the whole family.
+	s.RevokeFamily("a")
+	if _, found, _, _ := s.Use("b"); found {
+		t.Error("token of revoked family found")
+	}
+	if _, found, _, _ := s.Use("c"); !found {
+		t.Error("token of another family must not be revoked")
+	}
+
+	now = now.Add(time.Hour + time.Second)
+	s.Save(RefreshToken{ID: "d", Family: "d", User: user, ExpiresAt: now.Add(time.Hour)})
+	if _, ok := s.tokens["c"]; ok {
+		t.Error("expired token must be removed")
+	}
+	if _, ok := s.revoked["a"]; !ok {
+		t.Error("revoked family must be kept until its latest token expires")
+	}
+	if _, found, _, _ := s.Use("b"); found {
+		t.Error("token of revoked family found")
+	}
+}
+
+func TestRefreshTokenID(t *testing.T) {
+	tok, id, err := newRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tok) != 43 || id != refreshTokenID(tok) || id == tok {
+		t.Errorf("unexpected token %q and id %q", tok, id)
+	}
+}
@@ -0,0 +1,156 @@
+package vatel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/golangkit/vatel/jsonmask"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+// NDJSONMediaType is the media type of newline delimited JSON.
+const NDJSONMediaType = "application/x-ndjson"
+
+// StreamResulter is the interface what wraps a single method NextResult.
+//
+// If endpoint's controller implements StreamResulter, result items are written
+// to the response incrementally after Handle as JSON array, or as newline
+// delimited JSON if request header Accept prefers application/x-ndjson.
+//
+// NextResult returns the next item of the result. It returns ok false if there
+// are no more items. Error stops the stream, the response is truncated.
+// If controller implements io.Closer, Close is called when the stream ends.
+//
+// Request's context.Context is cancelled when the stream ends.
+type StreamResulter interface {
+	NextResult() (item interface{}, ok bool, err error)
+}
+
+// streamMediaType returns media type of the streamed result acceptable by the client.
+func streamMediaType(ctx *fasthttp.RequestCtx) (string, error) {
+
+	accept := ctx.Request.Header.Peek("Accept")
+	if len(accept) == 0 {
+		return "application/json", nil
+	}
+
+	for _, mr := range parseAccept(string(accept)) {
+		switch mr {
+		case NDJSONMediaType:
+			return NDJSONMediaType, nil
+		case "*/*", "application/*", "application/json":
+			return "application/json", nil
+		}
+	}
+	return "", ErrNotAcceptable.Capture()
+}
+
+// streamResult writes items returned by controller's NextResult as response
+// body of media type mt. cancel is called when the stream ends.
+func (e *Endpoint) streamResult(fctx *fasthttp.RequestCtx, s StreamResulter, mt string, lo LogOption, level zerolog.Level, zc zerolog.Context, cancel context.CancelFunc) {
+
+	ndjson := mt == NDJSONMediaType
+	fctx.SetContentType(mt + "; charset=utf-8")
+
+	// fctx must not be used inside of stream writer.
+	start := fctx.Time()
+	statusCode := fctx.Response.StatusCode()
+
+	fctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+
+		defer cancel()
+		if c, ok := s.(io.Closer); ok {
+			defer c.Close()
+		}
+
+		var (
+			items  int
+			size   int
+			err    error
+			fields jsonmask.Fields
+		)
+
+		write := func(b []byte) {
+			if err == nil {
+				var n int
+				n, err = w.Write(b)
+				size += n
+			}
+		}
+
+		if !ndjson {
+			write([]byte{'['})
+		}
+
+		for err == nil {
+			var (
+				item interface{}
+				ok   bool
+			)
+			if item, ok, err = s.NextResult(); err != nil || !ok {
+				break
+			}
+
+			var buf []byte
+			if buf, err = json.Marshal(item); err != nil {
+				break
+			}
+
+			if lo&LogRespBody == LogRespBody {
+				if items == 0 && e.jm != nil {
+					fields = e.jm.Fields(item, "mask")
+				}
+				e.logResultItem(zc, level, items, buf, fields)
+			}
+
+			if !ndjson && items > 0 {
+				write([]byte{','})
+			}
+			write(buf)
+			if ndjson {
+				write([]byte{'\n'})
+			}
+			items++
+		}
+
+		if !ndjson && err == nil {
+			write([]byte{']'})
+		}
+
+		dur := time.Since(start)
+		zl := zc.Logger()
+		switch {
+		case err != nil:
+			zl.Error().Str("err", err.Error()).Int("items", items).Int("size", size).Str("dur", dur.String()).Msg("result streaming failed")
+		case lo&LogExit == LogExit:
+			zl.WithLevel(level).Int("items", items).Int("size", size).Str("dur", dur.String()).Msg("result streamed")
+		}
+
+		if e.mr != nil {
+			e.mr.ReportMetric(e.Method, e.Path, statusCode, dur.Seconds(), size)
+		}
+	})
+}
+
+// logResultItem logs a single streamed item. Attributes having tag "mask" are masked.
+func (e *Endpoint) logResultItem(zc zerolog.Context, level zerolog.Level, i int, buf []byte, fields jsonmask.Fields) {
+
+	zc = zc.Int("item", i)
+	if e.jm == nil || len(fields) == 0 {
+		zl := zc.RawJSON("respBody", buf).Logger()
+		zl.WithLevel(level).Msg("result item")
+		return
+	}
+
+	masked, err := e.jm.Mask(buf, fields)
+	if err != nil {
+		masked = []byte(`{"maskingError": ` + strconv.Quote(err.Error()) + `}`)
+	}
+	zl := zc.RawJSON("maskedRespBody", masked).Logger()
+	zl.WithLevel(level).Msg("result item")
+}
@@ -0,0 +1,87 @@
+package vatel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/golangkit/vatel/jsonmask"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+type testReportController struct {
+	rows   []testCustomer
+	closed bool
+}
+
+func (c *testReportController) Handle(Context) error { return nil }
+
+func (c *testReportController) NextResult() (interface{}, bool, error) {
+	if len(c.rows) == 0 {
+		return nil, false, nil
+	}
+	row := c.rows[0]
+	c.rows = c.rows[1:]
+	return &row, true, nil
+}
+
+func (c *testReportController) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestEndpoint_streamResult(t *testing.T) {
+
+	jm := jsonmask.New()
+	jm.AddFunc("email", func(string) string { return "***" })
+
+	cases := []struct {
+		accept   string
+		status   int
+		expected string
+	}{
+		{"", 200, `[{"id":1,"name":"a","email":"a@b.c","Tags":null},{"id":2,"name":"b","email":"","Tags":null}]`},
+		{"application/x-ndjson", 200, "{\"id\":1,\"name\":\"a\",\"email\":\"a@b.c\",\"Tags\":null}\n{\"id\":2,\"name\":\"b\",\"email\":\"\",\"Tags\":null}\n"},
+		{"application/xml", 406, ""},
+	}
+
+	for _, c := range cases {
+		mr := testMetricReporter{}
+		ctrl := testReportController{rows: []testCustomer{{ID: 1, Name: "a", Email: "a@b.c"}, {ID: 2, Name: "b"}}}
+		e := Endpoint{Method: "GET", Path: "/report", LogOptions: LogFull, Controller: func() Handler { return &ctrl }}
+		if err := e.compile(NewVatel(WithMetricReporter(&mr), WithJsonMasker(jm))); err != nil {
+			t.Fatal(err)
+		}
+
+		var log bytes.Buffer
+		l := zerolog.New(&log)
+		var fctx fasthttp.RequestCtx
+		fctx.Request.Header.Set("Accept", c.accept)
+		e.handler(&l)(&fctx)
+
+		if fctx.Response.StatusCode() != c.status {
+			t.Errorf("%q: expected status %d, got %d", c.accept, c.status, fctx.Response.StatusCode())
+			continue
+		}
+		if c.status != 200 {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := fctx.Response.BodyWriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != c.expected {
+			t.Errorf("%q: expected %s, got %s", c.accept, c.expected, buf.String())
+		}
+
+		if !ctrl.closed || mr.statusCode != 200 {
+			t.Errorf("%q: expected closed controller and reported status, got %t %d", c.accept, ctrl.closed, mr.statusCode)
+		}
+		if !strings.Contains(log.String(), `"maskedRespBody":{"id":1,"name":"a","email":"***","Tags":null}`) ||
+			!strings.Contains(log.String(), `"items":2`) {
+			t.Errorf("%q: masked items expected in log: %s", c.accept, log.String())
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package vatel
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryRevokedTokenStore implements RevokeTokenChecker and TokenRevoker keeping
+// revoked access tokens in memory until their expiration.
+type MemoryRevokedTokenStore struct {
+	mu          sync.Mutex
+	revoked     map[string]time.Time
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+// NewMemoryRevokedTokenStore returns new in-memory storage of revoked access tokens.
+func NewMemoryRevokedTokenStore() *MemoryRevokedTokenStore {
+	return &MemoryRevokedTokenStore{
+		revoked: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// IsTokenRevoked implements RevokeTokenChecker.
+func (s *MemoryRevokedTokenStore) IsTokenRevoked(accessToken string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.revoked[accessToken]
+	return ok && !s.now().After(exp), nil
+}
+
+// RevokeToken implements TokenRevoker.
+func (s *MemoryRevokedTokenStore) RevokeToken(accessToken string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastCleanup) > memoryRefreshCleanupPeriod {
+		for at, exp := range s.revoked {
+			if now.After(exp) {
+				delete(s.revoked, at)
+			}
+		}
+		s.lastCleanup = now
+	}
+
+	s.revoked[accessToken] = expiresAt
+	return nil
+}
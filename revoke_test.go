@@ -0,0 +1,36 @@
+package vatel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRevokedTokenStore(t *testing.T) {
+
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryRevokedTokenStore()
+	s.now = func() time.Time { return now }
+
+	s.RevokeToken("a", now.Add(time.Hour))
+	s.RevokeToken("b", now.Add(time.Minute))
+
+	if ok, _ := s.IsTokenRevoked("a"); !ok {
+		t.Error("revoked token expected")
+	}
+	if ok, _ := s.IsTokenRevoked("x"); ok {
+		t.Error("unknown token must not be revoked")
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	if ok, _ := s.IsTokenRevoked("b"); ok {
+		t.Error("expired token must not be reported as revoked")
+	}
+
+	s.RevokeToken("c", now.Add(time.Hour))
+	if _, ok := s.revoked["b"]; ok {
+		t.Error("expired token must be removed")
+	}
+	if ok, _ := s.IsTokenRevoked("a"); !ok {
+		t.Error("revoked token expected")
+	}
+}
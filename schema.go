@@ -0,0 +1,325 @@
+package vatel
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axkit/date"
+	"github.com/google/uuid"
+)
+
+// Schema describes a data type as a subset of JSON Schema used by
+// OpenAPI 3.1 documents and endpoint descriptions.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+
+	// Mask holds value of the field's tag "mask".
+	Mask string `json:"x-mask,omitempty"`
+
+	// order holds property names in the order of struct fields declaration.
+	order []string
+}
+
+// PropertyNames returns property names in the order of struct fields declaration.
+func (s *Schema) PropertyNames() []string {
+	return s.order
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	dateType          = reflect.TypeOf(date.Date(0))
+	uuidType          = reflect.TypeOf(uuid.UUID{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaGenerator converts go types to Schema.
+//
+// If components is not nil, named structs are placed there and referenced
+// by $ref. Otherwise all structs are inlined.
+type schemaGenerator struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+	inProgress map[reflect.Type]bool
+}
+
+func newSchemaGenerator(useComponents bool) *schemaGenerator {
+	sg := schemaGenerator{
+		names:      make(map[reflect.Type]string),
+		inProgress: make(map[reflect.Type]bool),
+	}
+	if useComponents {
+		sg.components = make(map[string]*Schema)
+	}
+	return &sg
+}
+
+// schemaOf returns schema of the value v. Returns nil if v is nil.
+func (sg *schemaGenerator) schemaOf(v interface{}) *Schema {
+	if v == nil {
+		return nil
+	}
+	return sg.schema(reflect.TypeOf(v))
+}
+
+func (sg *schemaGenerator) schema(t reflect.Type) *Schema {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case dateType:
+		return &Schema{Type: "string", Format: "date"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "duration in nanoseconds"}
+	case uploadType:
+		return &Schema{Type: "string", Format: "binary"}
+	}
+
+	pt := reflect.PtrTo(t)
+	if t.Implements(jsonMarshalerType) || pt.Implements(jsonMarshalerType) {
+		return &Schema{}
+	}
+	if t.Implements(textMarshalerType) || pt.Implements(textMarshalerType) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: sg.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: sg.schema(t.Elem())}
+	case reflect.Struct:
+		return sg.structSchema(t)
+	}
+
+	// interface{} and everything else accepts any value.
+	return &Schema{}
+}
+
+func (sg *schemaGenerator) structSchema(t reflect.Type) *Schema {
+
+	if t.Name() == "" {
+		return sg.objectSchema(t)
+	}
+
+	if sg.components == nil {
+		if sg.inProgress[t] {
+			return &Schema{Type: "object", Description: "recursive reference to " + t.Name()}
+		}
+		sg.inProgress[t] = true
+		defer delete(sg.inProgress, t)
+		return sg.objectSchema(t)
+	}
+
+	name, ok := sg.names[t]
+	if !ok {
+		name = sg.componentName(t)
+		sg.names[t] = name
+		// reserves the name before going deeper, to support recursive types.
+		sg.components[name] = nil
+		sg.components[name] = sg.objectSchema(t)
+	}
+
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// componentName returns unique schema name for the type t. Type name is used
+// as is, if it's not taken yet by a type from another package.
+func (sg *schemaGenerator) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, ok := sg.components[name]; !ok {
+		return name
+	}
+
+	pkg := t.PkgPath()
+	if idx := strings.LastIndexByte(pkg, '/'); idx >= 0 {
+		pkg = pkg[idx+1:]
+	}
+	if pkg != "" {
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+
+	res := name
+	for i := 2; ; i++ {
+		if _, ok := sg.components[res]; !ok {
+			return res
+		}
+		res = name + strconv.Itoa(i)
+	}
+}
+
+func (sg *schemaGenerator) objectSchema(t reflect.Type) *Schema {
+	s := Schema{Type: "object", Properties: make(map[string]*Schema)}
+	sg.addFields(&s, t)
+	return &s
+}
+
+// formSchema returns schema of multipart form populated into struct t by fields
+// having tag "form".
+func (sg *schemaGenerator) formSchema(t reflect.Type) *Schema {
+	s := Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, f := range taggedFields(t, "form") {
+		name := f.Tag.Get("form")
+		if name == "-" {
+			continue
+		}
+		fs := sg.schema(f.Type)
+		if fs.applyValidationRules(f.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+		s.order = append(s.order, name)
+	}
+	return &s
+}
+
+// addFields adds struct fields to the schema properties following encoding/json
+// rules: fields of embedded structs without json tag are promoted.
+func (sg *schemaGenerator) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name, skip := jsonFieldName(f)
+		if skip {
+			continue
+		}
+
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				sg.addFields(s, ft)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		fs := sg.schema(f.Type)
+		fs.Mask = f.Tag.Get("mask")
+
+		if _, ok := s.Properties[name]; !ok {
+			s.order = append(s.order, name)
+		}
+		s.Properties[name] = fs
+
+		if fs.applyValidationRules(f.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// jsonFieldName returns name of the struct field as encoding/json does.
+// Returns skip=true if the field is ignored by encoding/json.
+func jsonFieldName(f reflect.StructField) (name string, skip bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+
+	if idx := strings.IndexByte(tag, ','); idx >= 0 {
+		tag = tag[:idx]
+	}
+
+	if tag == "" {
+		return f.Name, false
+	}
+	return tag, false
+}
+
+// applyValidationRules adds to the schema constraints defined by tag "validate".
+// Returns true if the value is required.
+func (s *Schema) applyValidationRules(tag string) (required bool) {
+
+	rules, err := parseValidationTag(tag)
+	if err != nil {
+		return false
+	}
+
+	for i := range rules {
+		r := &rules[i]
+		n := int(r.num)
+		switch r.name {
+		case "required":
+			required = true
+		case "min", "max", "len":
+			switch {
+			case s.Type == "integer" || s.Type == "number":
+				if r.name != "max" {
+					s.Minimum = &r.num
+				}
+				if r.name != "min" {
+					s.Maximum = &r.num
+				}
+			case s.Type == "array":
+				if r.name != "max" {
+					s.MinItems = &n
+				}
+				if r.name != "min" {
+					s.MaxItems = &n
+				}
+			case s.Type == "string":
+				if r.name != "max" {
+					s.MinLength = &n
+				}
+				if r.name != "min" {
+					s.MaxLength = &n
+				}
+			}
+		case "oneof":
+			s.Enum = r.opts
+		case "email":
+			s.Format = "email"
+		case "uuid":
+			s.Format = "uuid"
+		case "regexp":
+			s.Pattern = r.arg
+		}
+	}
+	return required
+}
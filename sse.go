@@ -0,0 +1,233 @@
+package vatel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axkit/errors"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+// DefaultEventKeepAlive is the default period of sending keep-alive comments to event stream.
+const DefaultEventKeepAlive = 15 * time.Second
+
+// Event is a single Server-Sent Event.
+type Event struct {
+	// ID is the event ID. Client sends the last received ID in header
+	// Last-Event-ID when reconnects.
+	ID string
+
+	// Event is the event type. Empty means "message".
+	Event string
+
+	// Data is the event payload. Values of type string and []byte are sent as is,
+	// other values are encoded to JSON.
+	Data interface{}
+
+	// Retry sets client's reconnection time if positive.
+	Retry time.Duration
+}
+
+// EventStreamer is the interface what wraps a single method Stream.
+//
+// If endpoint's controller implements EventStreamer, response is sent as
+// Server-Sent Events stream (text/event-stream). Stream is called after Handle
+// and sends events to the client until it returns or client disconnects.
+// Handle is called as usual and can be used to check request's parameters.
+type EventStreamer interface {
+	Stream(es *EventSink) error
+}
+
+// ErrEventStreamClosed is returned by EventSink.Send after the stream ended.
+var ErrEventStreamClosed = errors.New("event stream closed")
+
+// EventSink writes Server-Sent Events to the client.
+type EventSink struct {
+	mu          sync.Mutex
+	w           *bufio.Writer
+	ctx         context.Context
+	cancel      context.CancelFunc
+	lastEventID string
+	sent        int
+	size        int
+	err         error
+}
+
+// LastEventID returns ID of the last event received by the client before
+// reconnection, taken from header Last-Event-ID or query parameter lastEventId.
+func (es *EventSink) LastEventID() string {
+	return es.lastEventID
+}
+
+// Context returns context what is cancelled when client disconnects, endpoint's
+// Timeout is exceeded or the context set by WithBaseContext is cancelled.
+func (es *EventSink) Context() context.Context {
+	return es.ctx
+}
+
+// Send writes event to the client. Returns error if client disconnected.
+func (es *EventSink) Send(ev Event) error {
+
+	var buf bytes.Buffer
+	if ev.ID != "" {
+		buf.WriteString("id: " + singleLine(ev.ID) + "\n")
+	}
+	if ev.Event != "" {
+		buf.WriteString("event: " + singleLine(ev.Event) + "\n")
+	}
+	if ev.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(int64(ev.Retry/time.Millisecond), 10) + "\n")
+	}
+
+	var data string
+	switch x := ev.Data.(type) {
+	case nil:
+	case string:
+		data = x
+	case []byte:
+		data = string(x)
+	default:
+		b, err := json.Marshal(x)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		buf.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	buf.WriteByte('\n')
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if err := es.write(buf.Bytes()); err != nil {
+		return err
+	}
+	es.sent++
+	return nil
+}
+
+// comment writes comment line ignored by clients. It's used to keep connection alive.
+func (es *EventSink) comment(s string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.write([]byte(": " + s + "\n\n"))
+}
+
+// write writes and flushes b. The sink is closed after the first failed write.
+func (es *EventSink) write(b []byte) error {
+	if es.err != nil {
+		return es.err
+	}
+
+	n, err := es.w.Write(b)
+	if err == nil {
+		err = es.w.Flush()
+	}
+	es.size += n
+
+	if err != nil {
+		es.err = err
+		es.cancel()
+	}
+	return err
+}
+
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// streamEvents starts Server-Sent Events stream. Events are written by
+// controller's Stream after the request handler returns.
+func (e *Endpoint) streamEvents(fctx *fasthttp.RequestCtx, s EventStreamer, level zerolog.Level, zc zerolog.Context) {
+
+	lastEventID := string(fctx.Request.Header.Peek("Last-Event-ID"))
+	if lastEventID == "" {
+		lastEventID = string(fctx.QueryArgs().Peek("lastEventId"))
+	}
+
+	keepAlive := e.EventKeepAlive
+	if keepAlive <= 0 {
+		keepAlive = DefaultEventKeepAlive
+	}
+
+	fctx.SetStatusCode(fasthttp.StatusOK)
+	fctx.SetContentType("text/event-stream; charset=utf-8")
+	fctx.Response.Header.Set(fasthttp.HeaderCacheControl, "no-cache")
+	fctx.Response.Header.Set("X-Accel-Buffering", "no")
+
+	// fctx must not be used inside of stream writer.
+	start := fctx.Time()
+
+	fctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+		)
+		if e.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(e.baseCtx, e.Timeout)
+		} else {
+			ctx, cancel = context.WithCancel(e.baseCtx)
+		}
+		defer cancel()
+
+		es := &EventSink{w: w, ctx: ctx, cancel: cancel, lastEventID: lastEventID}
+
+		// headers are sent to the client at once.
+		es.comment("stream started")
+
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t := time.NewTicker(keepAlive)
+			defer t.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					es.comment("keep-alive")
+				}
+			}
+		}()
+
+		err := s.Stream(es)
+		close(done)
+		wg.Wait()
+
+		// w must not be used after the stream writer returns.
+		es.mu.Lock()
+		sent, size, werr := es.sent, es.size, es.err
+		if es.err == nil {
+			es.err = ErrEventStreamClosed
+		}
+		es.mu.Unlock()
+
+		dur := time.Since(start)
+		zl := zc.Logger()
+		switch {
+		case err != nil:
+			zl.Error().Str("err", err.Error()).Int("events", sent).Str("dur", dur.String()).Msg("event stream failed")
+		case werr != nil:
+			zl.WithLevel(level).Str("err", werr.Error()).Int("events", sent).Str("dur", dur.String()).Msg("event stream closed by client")
+		default:
+			zl.WithLevel(level).Int("events", sent).Str("dur", dur.String()).Msg("event stream completed")
+		}
+
+		if e.mr != nil {
+			e.mr.ReportMetric(e.Method, e.Path, fasthttp.StatusOK, dur.Seconds(), size)
+		}
+	})
+}
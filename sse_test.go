@@ -0,0 +1,114 @@
+package vatel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+type testEventController struct {
+	lastEventID string
+}
+
+func (c *testEventController) Handle(Context) error {
+	return nil
+}
+
+func (c *testEventController) Stream(es *EventSink) error {
+	c.lastEventID = es.LastEventID()
+	if err := es.Send(Event{ID: "8", Event: "status", Data: map[string]string{"status": "paid"}}); err != nil {
+		return err
+	}
+	return es.Send(Event{ID: "9", Data: "line1\nline2", Retry: 1500 * time.Millisecond})
+}
+
+func TestEndpoint_streamEvents(t *testing.T) {
+
+	mr := testMetricReporter{}
+	c := testEventController{}
+	e := NewEndpoint("GET", "/orders/events", nil, func() Handler { return &c })
+	if err := e.compile(NewVatel(WithMetricReporter(&mr))); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	var fctx fasthttp.RequestCtx
+	fctx.Request.Header.Set("Last-Event-ID", "7")
+	e.handler(&l)(&fctx)
+
+	if ct := string(fctx.Response.Header.ContentType()); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("unexpected content type %s", ct)
+	}
+
+	var buf bytes.Buffer
+	if err := fctx.Response.BodyWriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ": stream started\n\n" +
+		"id: 8\nevent: status\ndata: {\"status\":\"paid\"}\n\n" +
+		"id: 9\nretry: 1500\ndata: line1\ndata: line2\n\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	if c.lastEventID != "7" || mr.statusCode != 200 {
+		t.Errorf("unexpected last event id %q or reported status %d", c.lastEventID, mr.statusCode)
+	}
+
+	e = NewEndpoint("POST", "/orders/events", nil, func() Handler { return &c })
+	if err := e.compile(NewVatel()); err == nil {
+		t.Error("error expected for POST event stream")
+	}
+}
+
+type testWaitingEventController struct {
+	es *EventSink
+}
+
+func (c *testWaitingEventController) Handle(Context) error { return nil }
+
+func (c *testWaitingEventController) Stream(es *EventSink) error {
+	c.es = es
+	<-es.Context().Done()
+	return nil
+}
+
+func TestEndpoint_streamEventsTimeout(t *testing.T) {
+
+	c := testWaitingEventController{}
+	e := NewEndpoint("GET", "/orders/events", nil, func() Handler { return &c })
+	e.Timeout = 20 * time.Millisecond
+	e.EventKeepAlive = time.Millisecond
+	if err := e.compile(NewVatel()); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	var fctx fasthttp.RequestCtx
+	e.handler(&l)(&fctx)
+
+	done := make(chan struct{})
+	var buf bytes.Buffer
+	go func() {
+		fctx.Response.BodyWriteTo(&buf)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream must be cancelled by Timeout")
+	}
+
+	if !strings.Contains(buf.String(), ": keep-alive\n\n") {
+		t.Errorf("keep-alive expected, got %q", buf.String())
+	}
+	if err := c.es.Send(Event{Data: "late"}); err != ErrEventStreamClosed {
+		t.Errorf("ErrEventStreamClosed expected, got %v", err)
+	}
+}
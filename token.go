@@ -0,0 +1,107 @@
+package vatel
+
+import (
+	"bytes"
+
+	"github.com/valyala/fasthttp"
+)
+
+// TokenExtractor is the interface what wraps a single method ExtractToken.
+//
+// ExtractToken returns access token found in the request and the name of
+// its source (i.e. "header:Authorization", "cookie:session"). Returns nil
+// token if the request has no token.
+type TokenExtractor interface {
+	ExtractToken(ctx *fasthttp.RequestCtx) (token []byte, source string)
+}
+
+// TokenExtractorChain tries extractors one by one and returns the first found token.
+type TokenExtractorChain []TokenExtractor
+
+// ExtractToken implements TokenExtractor interface.
+func (c TokenExtractorChain) ExtractToken(ctx *fasthttp.RequestCtx) ([]byte, string) {
+	for i := range c {
+		if t, src := c[i].ExtractToken(ctx); len(t) > 0 {
+			return t, src
+		}
+	}
+	return nil, ""
+}
+
+// AuthorizationToken returns TokenExtractor taking the token from header
+// Authorization having the scheme (i.e. "Bearer"). Scheme is compared case
+// insensitive. If scheme is empty, the header value is returned as is.
+func AuthorizationToken(scheme string) TokenExtractor {
+	return authorizationToken(scheme)
+}
+
+type authorizationToken string
+
+func (s authorizationToken) ExtractToken(ctx *fasthttp.RequestCtx) ([]byte, string) {
+	hv := ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)
+	if s == "" {
+		return hv, "header:Authorization"
+	}
+
+	if len(hv) <= len(s) || !bytes.EqualFold(hv[:len(s)], []byte(s)) || hv[len(s)] != ' ' {
+		return nil, ""
+	}
+	return bytes.TrimSpace(hv[len(s):]), "header:Authorization:" + string(s)
+}
+
+// HeaderToken returns TokenExtractor taking the token from request header name
+// (i.e. "X-API-Key").
+func HeaderToken(name string) TokenExtractor {
+	return headerToken(name)
+}
+
+type headerToken string
+
+func (h headerToken) ExtractToken(ctx *fasthttp.RequestCtx) ([]byte, string) {
+	return ctx.Request.Header.Peek(string(h)), "header:" + string(h)
+}
+
+// CookieToken returns TokenExtractor taking the token from cookie name.
+func CookieToken(name string) TokenExtractor {
+	return cookieToken(name)
+}
+
+type cookieToken string
+
+func (c cookieToken) ExtractToken(ctx *fasthttp.RequestCtx) ([]byte, string) {
+	return ctx.Request.Header.Cookie(string(c)), "cookie:" + string(c)
+}
+
+// QueryToken returns TokenExtractor taking the token from URL query parameter
+// name. It's useful for download links opened by browser.
+func QueryToken(name string) TokenExtractor {
+	return queryToken(name)
+}
+
+type queryToken string
+
+func (q queryToken) ExtractToken(ctx *fasthttp.RequestCtx) ([]byte, string) {
+	return ctx.QueryArgs().Peek(string(q)), "query:" + string(q)
+}
+
+// defaultTokenExtractor passes header Authorization to TokenDecoder as is.
+var defaultTokenExtractor = AuthorizationToken("")
+
+// maskToken returns token's prefix and suffix what are safe to be logged.
+func maskToken(t []byte) string {
+	if len(t) < 16 {
+		return "***"
+	}
+	return string(t[:4]) + "***" + string(t[len(t)-4:])
+}
+
+// SetTokenExtractor assigns the way of taking access token from the request.
+// Several extractors are tried in the given order. By default, header
+// Authorization is passed to TokenDecoder as is.
+func (v *Vatel) SetTokenExtractor(te ...TokenExtractor) {
+	if len(te) == 1 {
+		v.te = te[0]
+		return
+	}
+	v.te = TokenExtractorChain(te)
+}
@@ -0,0 +1,83 @@
+package vatel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+type testWhoAmIController struct {
+	login string
+}
+
+func (c *testWhoAmIController) Result() interface{} { return &c.login }
+func (c *testWhoAmIController) Handle(ctx Context) error {
+	c.login = ctx.TokenPayload().Login()
+	return nil
+}
+
+func TestEndpoint_tokenExtractor(t *testing.T) {
+
+	const token = "john-0123456789abcdef"
+
+	cases := []struct {
+		name     string
+		global   []TokenExtractor
+		endpoint TokenExtractor
+		prepare  func(r *fasthttp.Request)
+		status   int
+		source   string
+	}{
+		{"raw header", nil, nil, func(r *fasthttp.Request) { r.Header.Set("Authorization", token) }, 200, "header:Authorization"},
+		{"bearer", []TokenExtractor{AuthorizationToken("Bearer")}, nil, func(r *fasthttp.Request) { r.Header.Set("Authorization", "bearer "+token) }, 200, "header:Authorization:Bearer"},
+		{"wrong scheme", []TokenExtractor{AuthorizationToken("Bearer")}, nil, func(r *fasthttp.Request) { r.Header.Set("Authorization", "Basic "+token) }, 401, ""},
+		{"cookie", []TokenExtractor{AuthorizationToken("Bearer"), CookieToken("session")}, nil, func(r *fasthttp.Request) { r.Header.SetCookie("session", token) }, 200, "cookie:session"},
+		{"chain order", []TokenExtractor{AuthorizationToken("Bearer"), CookieToken("session")}, nil, func(r *fasthttp.Request) {
+			r.Header.SetCookie("session", "mary-0123456789abcdef")
+			r.Header.Set("Authorization", "Bearer "+token)
+		}, 200, "header:Authorization:Bearer"},
+		{"api key", []TokenExtractor{HeaderToken("X-API-Key")}, nil, func(r *fasthttp.Request) { r.Header.Set("X-API-Key", token) }, 200, "header:X-API-Key"},
+		{"endpoint query", []TokenExtractor{AuthorizationToken("Bearer")}, QueryToken("access_token"), func(r *fasthttp.Request) { r.SetRequestURI("/whoami?access_token=" + token) }, 200, "query:access_token"},
+		{"missed", []TokenExtractor{CookieToken("session")}, nil, func(r *fasthttp.Request) {}, 401, ""},
+	}
+
+	for _, c := range cases {
+		v := newTestVatel()
+		if c.global != nil {
+			v.SetTokenExtractor(c.global...)
+		}
+
+		e := Endpoint{Method: "GET", Path: "/whoami", Perms: []string{"WhoAmI"}, LogOptions: LogExit, TokenExtractor: c.endpoint,
+			Controller: func() Handler { return &testWhoAmIController{} }}
+		if err := e.compile(v); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		l := zerolog.New(&buf)
+
+		var fctx fasthttp.RequestCtx
+		c.prepare(&fctx.Request)
+		e.handler(&l)(&fctx)
+
+		if sc := fctx.Response.StatusCode(); sc != c.status {
+			t.Errorf("%s: expected status %d, got %d %s", c.name, c.status, sc, fctx.Response.Body())
+			continue
+		}
+		if c.status != 200 {
+			continue
+		}
+		if string(fctx.Response.Body()) != `"`+token+`"` {
+			t.Errorf("%s: unexpected body %s", c.name, fctx.Response.Body())
+		}
+		if !strings.Contains(buf.String(), `"tokenSource":"`+c.source+`"`) || !strings.Contains(buf.String(), `"token":"john***cdef"`) {
+			t.Errorf("%s: token source and masked token expected in log: %s", c.name, buf.String())
+		}
+		if strings.Contains(buf.String(), token) {
+			t.Errorf("%s: token must not be logged: %s", c.name, buf.String())
+		}
+	}
+}
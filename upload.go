@@ -0,0 +1,319 @@
+package vatel
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/axkit/errors"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+// DefaultMaxUploadSize is the default maximum size of an uploaded file.
+const DefaultMaxUploadSize = 32 << 20
+
+// maxFormValueSize is the maximum size of a multipart form value what is not a file.
+const maxFormValueSize = 1 << 20
+
+var (
+	ErrUploadTooLarge       = errors.New("uploaded file is too large").Code("VTL-0012").StatusCode(413)
+	ErrUploadTypeNotAllowed = errors.New("uploaded file type is not allowed").Code("VTL-0013").StatusCode(415)
+)
+
+var uploadType = reflect.TypeOf(Upload{})
+
+// UploadStorage is the interface what wraps methods Save, Open and Remove.
+//
+// Save stores content of uploaded file and returns the key what identifies
+// it in the storage. Partially saved content must be removed by Save if it fails.
+//
+// Open returns content of the file stored by Save.
+//
+// Remove deletes the file. It's called after Handle returns for all
+// uploads not marked by Upload.Keep.
+type UploadStorage interface {
+	Save(r io.Reader, filename string) (key string, err error)
+	Open(key string) (io.ReadCloser, error)
+	Remove(key string) error
+}
+
+// TempDirStorage is the UploadStorage what keeps files in the directory Dir.
+// Key is the path of the file. The default temporary directory is used if Dir is empty.
+type TempDirStorage struct {
+	Dir string
+}
+
+// Save implements UploadStorage interface.
+func (s TempDirStorage) Save(r io.Reader, filename string) (string, error) {
+	f, err := ioutil.TempFile(s.Dir, "upload-*")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Open implements UploadStorage interface.
+func (s TempDirStorage) Open(key string) (io.ReadCloser, error) {
+	return os.Open(key)
+}
+
+// Remove implements UploadStorage interface.
+func (s TempDirStorage) Remove(key string) error {
+	return os.Remove(key)
+}
+
+// UploadPolicy defines limits of files uploaded to multipart endpoint.
+type UploadPolicy struct {
+	// MaxFileSize is the maximum size of a single file. Default is DefaultMaxUploadSize.
+	MaxFileSize int64
+
+	// AllowedTypes holds media types (i.e. "image/png", "image/*") of allowed files.
+	// Media type is detected by file content, header Content-Type of the part is ignored.
+	// All types are allowed if empty.
+	AllowedTypes []string
+
+	// Storage keeps uploaded files. Default is TempDirStorage with the default
+	// temporary directory.
+	Storage UploadStorage
+}
+
+func (p *UploadPolicy) isTypeAllowed(mt string) bool {
+	if len(p.AllowedTypes) == 0 {
+		return true
+	}
+	for _, at := range p.AllowedTypes {
+		if at == mt || strings.HasSuffix(at, "/*") && strings.HasPrefix(mt, at[:len(at)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Upload is the handle of uploaded file. Fields of Input struct having type
+// *Upload or []*Upload and tag "form" are populated by files of multipart request.
+type Upload struct {
+	Filename  string `json:"filename"`
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+	Key       string `json:"key"`
+
+	storage UploadStorage
+	kept    bool
+}
+
+// Open returns content of uploaded file.
+func (u *Upload) Open() (io.ReadCloser, error) {
+	return u.storage.Open(u.Key)
+}
+
+// Keep marks the file to be left in the storage after Handle returns.
+func (u *Upload) Keep() {
+	u.kept = true
+}
+
+// limitedReader returns ErrUploadTooLarge if more than n bytes are read.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	if lr.n -= int64(n); lr.n < 0 {
+		return n, ErrUploadTooLarge.Capture()
+	}
+	return n, err
+}
+
+// hasFormTags returns true if struct t has fields with tag "form".
+func hasFormTags(t reflect.Type) bool {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("form") != "" || f.Anonymous && hasFormTags(f.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// formFields returns fields of struct s having tag "form", including fields
+// of embedded structs.
+func formFields(s reflect.Value, res map[string]reflect.Value) map[string]reflect.Value {
+	t := s.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if tag := f.Tag.Get("form"); tag != "" && tag != "-" {
+			res[tag] = s.Field(i)
+		} else if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			formFields(s.Field(i), res)
+		}
+	}
+	return res
+}
+
+func isUploadField(v reflect.Value) bool {
+	t := v.Type()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Ptr && t.Elem() == uploadType
+}
+
+// decodeMultipart populates struct in with multipart request's form values
+// and files. Files are saved to the storage while the body is read. The body
+// is read as a stream if server has option StreamRequestBody.
+func (e *Endpoint) decodeMultipart(ctx *fasthttp.RequestCtx, in interface{}) error {
+
+	boundary := ctx.Request.Header.MultipartFormBoundary()
+	if len(boundary) == 0 {
+		return ErrUnsupportedMediaType.Capture()
+	}
+
+	body := ctx.RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(ctx.Request.Body())
+	}
+
+	fields := formFields(reflect.ValueOf(in).Elem(), make(map[string]reflect.Value))
+	vals := make(map[string][]string)
+
+	mr := multipart.NewReader(body, string(boundary))
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Catch(err).StatusCode(400).Msg("invalid multipart body")
+		}
+
+		name := p.FormName()
+		f, ok := fields[name]
+		if !ok {
+			continue
+		}
+
+		if !isUploadField(f) {
+			buf, err := ioutil.ReadAll(io.LimitReader(p, maxFormValueSize+1))
+			if err != nil {
+				return errors.Catch(err).StatusCode(400).Msg("invalid multipart body")
+			}
+			if len(buf) > maxFormValueSize {
+				return errors.ValidationFailed("form value is too large").Set("field", name)
+			}
+			vals[name] = append(vals[name], string(buf))
+			continue
+		}
+
+		if f.Kind() == reflect.Ptr && !f.IsNil() {
+			return errors.ValidationFailed("single file expected").Set("field", name)
+		}
+
+		u, err := e.saveUpload(p)
+		if err != nil {
+			return err
+		}
+
+		if f.Kind() == reflect.Slice {
+			f.Set(reflect.Append(f, reflect.ValueOf(u)))
+		} else {
+			f.Set(reflect.ValueOf(u))
+		}
+	}
+
+	for name, f := range fields {
+		if len(vals[name]) == 0 {
+			continue
+		}
+		if err := decodeField(f, vals[name]); err != nil {
+			return invalidParamError(err, name, vals[name])
+		}
+	}
+	return nil
+}
+
+// saveUpload checks size and sniffed media type of the file part and saves it to the storage.
+func (e *Endpoint) saveUpload(p *multipart.Part) (*Upload, error) {
+
+	lr := limitedReader{r: p, n: e.upload.MaxFileSize}
+
+	// http.DetectContentType considers at most 512 bytes.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(&lr, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	mt := mediaType([]byte(http.DetectContentType(head)))
+	if !e.upload.isTypeAllowed(mt) {
+		return nil, ErrUploadTypeNotAllowed.Capture()
+	}
+
+	cr := countingReader{r: io.MultiReader(bytes.NewReader(head), &lr)}
+	key, err := e.upload.Storage.Save(&cr, p.FileName())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Upload{Filename: p.FileName(), MediaType: mt, Size: cr.n, Key: key, storage: e.upload.Storage}, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// removeUploads removes files of in what are not marked by Upload.Keep.
+func (e *Endpoint) removeUploads(in interface{}, zc zerolog.Context) {
+
+	remove := func(u *Upload) {
+		if u == nil || u.kept {
+			return
+		}
+		if err := u.storage.Remove(u.Key); err != nil {
+			zl := zc.Logger()
+			zl.Error().Str("err", err.Error()).Str("key", u.Key).Msg("uploaded file removing failed")
+		}
+	}
+
+	for _, f := range formFields(reflect.ValueOf(in).Elem(), make(map[string]reflect.Value)) {
+		if !isUploadField(f) {
+			continue
+		}
+		if f.Kind() == reflect.Slice {
+			for i := 0; i < f.Len(); i++ {
+				remove(f.Index(i).Interface().(*Upload))
+			}
+			continue
+		}
+		remove(f.Interface().(*Upload))
+	}
+}
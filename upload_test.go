@@ -0,0 +1,134 @@
+package vatel
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+type testUploadController struct {
+	in struct {
+		Title string    `form:"title" validate:"required"`
+		Count int       `form:"count"`
+		Photo *Upload   `form:"photo" validate:"required"`
+		Docs  []*Upload `form:"docs"`
+	}
+	photo []byte
+}
+
+func (c *testUploadController) Input() interface{} { return &c.in }
+
+func (c *testUploadController) Handle(Context) error {
+	f, err := c.in.Photo.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	c.photo, err = ioutil.ReadAll(f)
+	if len(c.in.Docs) > 0 {
+		c.in.Docs[0].Keep()
+	}
+	return err
+}
+
+func testMultipartBody(t *testing.T, fields map[string]string, files map[string][]byte) ([]byte, string) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	for k, v := range files {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+k+`"; filename="`+k+`.png"`)
+		// client's content type is not trusted.
+		h.Set("Content-Type", "image/png")
+		pw, err := w.CreatePart(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pw.Write(v)
+	}
+	w.Close()
+	return buf.Bytes(), w.FormDataContentType()
+}
+
+func TestEndpoint_upload(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "vatel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name   string
+		fields map[string]string
+		files  map[string][]byte
+		status int
+		kept   int
+	}{
+		{"ok", map[string]string{"title": "x", "count": "2"}, map[string][]byte{"photo": testPNG, "docs": testPNG}, 204, 1},
+		{"type", map[string]string{"title": "x"}, map[string][]byte{"photo": []byte("plain text")}, 415, 0},
+		{"size", map[string]string{"title": "x"}, map[string][]byte{"photo": append(testPNG, make([]byte, 1024)...)}, 413, 0},
+		{"validation", nil, map[string][]byte{"photo": testPNG}, 400, 0},
+		{"count", map[string]string{"title": "x", "count": "a"}, map[string][]byte{"photo": testPNG}, 400, 0},
+	}
+
+	for _, c := range cases {
+		ctrl := testUploadController{}
+		e := Endpoint{Method: "POST", Path: "/photos",
+			Upload:     &UploadPolicy{MaxFileSize: 1024, AllowedTypes: []string{"image/*"}, Storage: TempDirStorage{Dir: dir}},
+			Controller: func() Handler { return &ctrl }}
+		if err := e.compile(NewVatel()); err != nil {
+			t.Fatal(err)
+		}
+
+		body, ct := testMultipartBody(t, c.fields, c.files)
+
+		l := zerolog.Nop()
+		var fctx fasthttp.RequestCtx
+		fctx.Request.Header.SetMethod("POST")
+		fctx.Request.Header.SetContentType(ct)
+		fctx.Request.SetBody(body)
+		e.handler(&l)(&fctx)
+
+		if sc := fctx.Response.StatusCode(); sc != c.status {
+			t.Errorf("%s: expected status %d, got %d %s", c.name, c.status, sc, fctx.Response.Body())
+		}
+
+		left, _ := ioutil.ReadDir(dir)
+		if len(left) != c.kept {
+			t.Errorf("%s: expected %d kept files, got %d", c.name, c.kept, len(left))
+		}
+		for _, fi := range left {
+			os.Remove(dir + "/" + fi.Name())
+		}
+
+		if c.status == 204 {
+			if ctrl.in.Title != "x" || ctrl.in.Count != 2 || ctrl.in.Photo.MediaType != "image/png" || !bytes.Equal(ctrl.photo, testPNG) {
+				t.Errorf("unexpected input %+v, photo %q", ctrl.in, ctrl.photo)
+			}
+		}
+	}
+
+	e := Endpoint{Method: "POST", Path: "/photos", Controller: func() Handler { return &testUploadController{} }}
+	if err := e.compile(NewVatel()); err != nil {
+		t.Fatal(err)
+	}
+	l := zerolog.Nop()
+	var fctx fasthttp.RequestCtx
+	fctx.Request.SetBody([]byte(`{"title":"x"}`))
+	e.handler(&l)(&fctx)
+	if fctx.Response.StatusCode() != 415 || !strings.Contains(string(fctx.Response.Body()), "VTL-0004") {
+		t.Errorf("415 expected for JSON body, got %d %s", fctx.Response.StatusCode(), fctx.Response.Body())
+	}
+}
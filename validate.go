@@ -0,0 +1,362 @@
+package vatel
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/axkit/errors"
+	"github.com/google/uuid"
+)
+
+// FieldError describes a single failed validation rule. Validation errors are
+// returned to the client as array under the attribute "reason".
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"msg"`
+}
+
+// ErrValidationFailed is returned when Param or Input struct has values not
+// satisfying tag "validate". Failed rules are set as field "reason".
+var ErrValidationFailed = errors.ValidationFailed("validation failed").Code("VTL-0003")
+
+// validationRule holds a single parsed rule of tag "validate".
+//
+// Supported rules:
+//
+//	required        - value is not zero (pointer is not nil, string is not empty)
+//	min=N, max=N    - number value or length of string, slice, map
+//	len=N           - exact length of string, slice, map
+//	oneof=a|b|c     - value is one of listed
+//	email           - string is an email address
+//	uuid            - string is UUID
+//	regexp=PATTERN  - string matches regular expression. Must be the last rule
+//	                  because PATTERN may contain commas.
+//
+// All rules except required are not checked if value is zero.
+type validationRule struct {
+	name string
+	arg  string
+	num  float64
+	opts []string
+	re   *regexp.Regexp
+}
+
+// validationRulesCache holds parsed tags. Key is tag value.
+var validationRulesCache sync.Map
+
+// parseValidationTag parses value of tag "validate".
+func parseValidationTag(tag string) ([]validationRule, error) {
+
+	if tag == "" {
+		return nil, nil
+	}
+
+	if res, ok := validationRulesCache.Load(tag); ok {
+		return res.([]validationRule), nil
+	}
+
+	var res []validationRule
+
+	for s := tag; s != ""; {
+		var item string
+		if strings.HasPrefix(s, "regexp=") {
+			item, s = s, ""
+		} else if idx := strings.IndexByte(s, ','); idx >= 0 {
+			item, s = s[:idx], s[idx+1:]
+		} else {
+			item, s = s, ""
+		}
+
+		r := validationRule{name: item}
+		if idx := strings.IndexByte(item, '='); idx >= 0 {
+			r.name, r.arg = item[:idx], item[idx+1:]
+		}
+
+		var err error
+		switch r.name {
+		case "required", "email", "uuid":
+			if r.arg != "" {
+				err = fmt.Errorf("rule %s does not expect argument", r.name)
+			}
+		case "min", "max", "len":
+			r.num, err = strconv.ParseFloat(r.arg, 64)
+		case "oneof":
+			r.opts = strings.Split(r.arg, "|")
+		case "regexp":
+			r.re, err = regexp.Compile(r.arg)
+		default:
+			err = fmt.Errorf("unknown rule %q", r.name)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag validate:%q: %s", tag, err.Error())
+		}
+		res = append(res, r)
+	}
+
+	validationRulesCache.Store(tag, res)
+	return res, nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isScalarType returns true if the type is represented by a single value
+// in JSON or URL even though it's a struct or an array (time.Time, uuid.UUID, etc).
+func isScalarType(t reflect.Type) bool {
+	switch t {
+	case timeType, dateType, uuidType, durationType:
+		return true
+	}
+	return reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// checkValidationTags checks syntax of all "validate" tags of the type.
+func checkValidationTags(t reflect.Type) error {
+	return checkTypeValidationTags(t, make(map[reflect.Type]bool))
+}
+
+func checkTypeValidationTags(t reflect.Type, seen map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || isScalarType(t) || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, err := parseValidationTag(f.Tag.Get("validate")); err != nil {
+			return fmt.Errorf("field %s.%s: %s", t.Name(), f.Name, err.Error())
+		}
+		if err := checkTypeValidationTags(f.Type, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateStruct checks fields of the struct s against rules in tag "validate".
+//
+// Field names in the result are taken from tag nameTag. If nameTag is "json"
+// nested structs are validated with dotted names (e.g. "address.city", "items[0].name").
+// If nameTag is "param" fields of nested structs are validated as top level ones.
+func validateStruct(s interface{}, nameTag string) []FieldError {
+	var res []FieldError
+	validateValue(reflect.ValueOf(s), nameTag, "", &res)
+	return res
+}
+
+func validateValue(v reflect.Value, nameTag, prefix string, res *[]FieldError) {
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if isScalarType(v.Type()) {
+			return
+		}
+	case reflect.Slice, reflect.Array:
+		if nameTag == "json" {
+			for i := 0; i < v.Len(); i++ {
+				validateValue(v.Index(i), nameTag, prefix+"["+strconv.Itoa(i)+"]", res)
+			}
+		}
+		return
+	default:
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		var name string
+		if nameTag == "json" {
+			var skip bool
+			if name, skip = jsonFieldName(f); skip {
+				continue
+			}
+			if f.Anonymous && f.Tag.Get("json") == "" {
+				validateValue(fv, nameTag, prefix, res)
+				continue
+			}
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+		} else {
+			name = f.Tag.Get(nameTag)
+			if name == "" {
+				validateValue(fv, nameTag, prefix, res)
+				continue
+			}
+		}
+
+		rules, _ := parseValidationTag(f.Tag.Get("validate"))
+		for i := range rules {
+			if msg := rules[i].check(fv); msg != "" {
+				*res = append(*res, FieldError{Field: name, Rule: rules[i].name, Message: msg})
+				break
+			}
+		}
+
+		if nameTag == "json" {
+			validateValue(fv, nameTag, name, res)
+		}
+	}
+}
+
+// check returns error message if value v does not satisfy the rule.
+func (r *validationRule) check(v reflect.Value) string {
+
+	if r.name == "required" {
+		if isZeroValue(v) {
+			return "is required"
+		}
+		return ""
+	}
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	if isZeroValue(v) {
+		return ""
+	}
+
+	switch r.name {
+	case "min", "max", "len":
+		n, isLen, ok := measure(v)
+		if !ok {
+			return ""
+		}
+		what := "value"
+		if isLen {
+			what = "length"
+		}
+		switch {
+		case r.name == "min" && n < r.num:
+			return what + " must be at least " + r.arg
+		case r.name == "max" && n > r.num:
+			return what + " must be at most " + r.arg
+		case r.name == "len" && n != r.num:
+			return what + " must be equal to " + r.arg
+		}
+	case "oneof":
+		s := valueString(v)
+		for i := range r.opts {
+			if r.opts[i] == s {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(r.opts, ", ")
+	case "email":
+		if v.Kind() != reflect.String {
+			return ""
+		}
+		if a, err := mail.ParseAddress(v.String()); err != nil || a.Address != v.String() {
+			return "must be a valid email address"
+		}
+	case "uuid":
+		if v.Kind() != reflect.String {
+			return ""
+		}
+		if _, err := uuid.Parse(v.String()); err != nil {
+			return "must be a valid UUID"
+		}
+	case "regexp":
+		if v.Kind() != reflect.String {
+			return ""
+		}
+		if !r.re.MatchString(v.String()) {
+			return "must match pattern " + r.arg
+		}
+	}
+	return ""
+}
+
+// measure returns number value or length of v used by rules min, max and len.
+func measure(v reflect.Value) (n float64, isLen bool, ok bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true, true
+	}
+	return 0, false, false
+}
+
+// isZeroValue returns true if v is zero value. Empty slices and maps are zero as well.
+func isZeroValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// valueString returns string representation of a scalar value.
+func valueString(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	}
+	return ""
+}
+
+// validationError converts field errors to a single error with status code 400.
+// Returns nil if fe is empty.
+func validationError(fe []FieldError) error {
+	if len(fe) == 0 {
+		return nil
+	}
+
+	buf, err := json.Marshal(fe)
+	if err != nil {
+		return err
+	}
+
+	return newValidationError(buf)
+}
+
+// newValidationError returns new error equal to ErrValidationFailed with reason.
+func newValidationError(reason []byte) error {
+	return errors.ValidationFailed("validation failed").Code("VTL-0003").Set("reason", reason)
+}
@@ -0,0 +1,90 @@
+package vatel
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/axkit/errors"
+)
+
+func TestValidateStruct(t *testing.T) {
+
+	type Item struct {
+		Name string `json:"name" validate:"required"`
+	}
+
+	in := struct {
+		Name   string  `json:"name" validate:"required,min=2,max=5"`
+		Kind   string  `json:"kind" validate:"oneof=a|b"`
+		Email  string  `json:"email" validate:"email"`
+		ID     string  `json:"id" validate:"uuid"`
+		Code   string  `json:"code" validate:"regexp=^[A-Z]{2,3}$"`
+		Age    int     `json:"age" validate:"min=18"`
+		Note   *string `json:"note" validate:"required"`
+		Items  []Item  `json:"items" validate:"max=1"`
+		Ignore string  `json:"-" validate:"required"`
+	}{
+		Name:  "Robert",
+		Kind:  "c",
+		Email: "robert",
+		ID:    "123",
+		Code:  "abc",
+		Age:   17,
+		Items: []Item{{Name: "x"}, {}},
+	}
+
+	fe := validateStruct(&in, "json")
+
+	var res []string
+	for i := range fe {
+		res = append(res, fe[i].Field+":"+fe[i].Rule)
+	}
+
+	expected := "name:max kind:oneof email:email id:uuid code:regexp age:min note:required items:max items[1].name:required"
+	if strings.Join(res, " ") != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, strings.Join(res, " "))
+	}
+
+	err := validationError(fe)
+	ce, ok := err.(*errors.CatchedError)
+	if !ok || ce.Last().StatusCode != 400 {
+		t.Fatalf("expected CatchedError with status code 400, got %v", err)
+	}
+	if _, ok := ce.Get("reason"); !ok {
+		t.Error("expected reason")
+	}
+
+	if validationError(validateStruct(&struct {
+		Age int `param:"age" validate:"min=18"`
+	}{}, "param")) != nil {
+		t.Error("zero value must not be validated if it's not required")
+	}
+}
+
+func TestParseValidationTag(t *testing.T) {
+	if _, err := parseValidationTag("required,unknown"); err == nil {
+		t.Error("error expected for unknown rule")
+	}
+
+	r, err := parseValidationTag("min=1,regexp=^(a,b)$")
+	if err != nil || len(r) != 2 || r[1].arg != "^(a,b)$" {
+		t.Errorf("unexpected result: %v, %v", r, err)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	err := validationError([]FieldError{{Field: "name", Rule: "required", Message: "is required"}})
+	ce, ok := err.(*errors.CatchedError)
+	if !ok || ce.GetCode() != "VTL-0003" || ce.Last().StatusCode != 400 {
+		t.Fatalf("unexpected error %#v", err)
+	}
+	if r, _ := ce.Get("reason"); !strings.Contains(string(r.([]byte)), `"field":"name"`) {
+		t.Errorf("unexpected reason %s", r)
+	}
+	if _, ok := ErrValidationFailed.Get("reason"); ok {
+		t.Error("reason must not be set to ErrValidationFailed")
+	}
+	if validationError(nil) != nil {
+		t.Error("nil expected")
+	}
+}
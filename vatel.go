@@ -1,8 +1,10 @@
 package vatel
 
 import (
+	"context"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/fasthttp/router"
 	"github.com/golangkit/vatel/jsonmask"
@@ -60,6 +62,15 @@ type RevokeTokenChecker interface {
 	IsTokenRevoked(accessToken string) (bool, error)
 }
 
+// TokenRevoker is the interface what wraps a single method RevokeToken.
+//
+// RevokeToken registers access token as revoked. The token can be forgotten
+// after expiresAt. Logout endpoint of TokenEndpoints requires RevokeTokenChecker
+// implementing TokenRevoker.
+type TokenRevoker interface {
+	RevokeToken(accessToken string, expiresAt time.Time) error
+}
+
 // TokenDecoder is the interface what wraps a single method Decode.
 //
 // TokenDecoder decodes token and returns object Tokener.
@@ -67,6 +78,14 @@ type TokenDecoder interface {
 	Decode(encodedToken []byte) (Tokener, error)
 }
 
+// TokenIssuer is the interface what wraps a single method IssueToken.
+//
+// IssueToken returns signed access token carrying payload p and its expiration time.
+// The token must be accepted by TokenDecoder.
+type TokenIssuer interface {
+	IssueToken(p TokenPayloader) (accessToken string, expiresAt time.Time, err error)
+}
+
 // MetricReporter is the interface what wraps a single method ReportMetric.
 //
 // HTTP requests handler uses MetricReporter to submit processing metrics to prometheus.
@@ -74,6 +93,15 @@ type MetricReporter interface {
 	ReportMetric(method, path string, statusCode int, dur float64, size int)
 }
 
+// InFlightReporter is the interface what wraps methods RequestStarted and RequestFinished.
+//
+// If MetricReporter implements InFlightReporter, HTTP requests handler reports
+// beginning and end of every request processing.
+type InFlightReporter interface {
+	RequestStarted(method, path string)
+	RequestFinished(method, path string)
+}
+
 type Logger interface {
 	Log()
 }
@@ -86,11 +114,18 @@ type Vatel struct {
 	pm   PermissionManager
 	rd   RequestDebugger
 	rtc  RevokeTokenChecker
+	te   TokenExtractor
+	rls  RateLimitStore
+	ids  IdempotencyStore
+	rc   ResponseCache
 
 	mdw middlewareSet
 
 	authDisabled bool
 	cfg          Option
+
+	reverts logReverts
+	ws      wsRegistry
 }
 
 // NewVatel returns new instance of Vatel.
@@ -102,7 +137,11 @@ func NewVatel(optFunc ...func(*Option)) *Vatel {
 		optFunc[i](&v.cfg)
 	}
 
-	v.ep = []Endpoint{{Method: "GET", Path: "/", Controller: func() Handler { return &tocController{s: &v} }}}
+	v.ep = []Endpoint{{Method: "GET", Path: "/", internal: true, Controller: func() Handler { return &tocController{s: &v} }}}
+
+	if v.cfg.openAPIPath != "" {
+		v.ep = append(v.ep, Endpoint{Method: "GET", Path: v.cfg.openAPIPath, internal: true, Controller: func() Handler { return &openAPIController{s: &v} }})
+	}
 	return &v
 }
 
@@ -115,6 +154,10 @@ type Option struct {
 	jm                 JsonMasker
 	ala                Alarmer
 	mr                 MetricReporter
+	openAPIPath        string
+	openAPIInfo        OpenAPIInfo
+	cors               *CORSPolicy
+	baseCtx            context.Context
 }
 
 func WithMetricReporter(mr MetricReporter) func(*Option) {
@@ -123,6 +166,26 @@ func WithMetricReporter(mr MetricReporter) func(*Option) {
 	}
 }
 
+// WithOpenAPI registers endpoint GET path what serves OpenAPI 3.1 document
+// describing all registered endpoints. The document is returned as JSON,
+// or as YAML if request has query parameter format=yaml or header Accept
+// mentions yaml.
+func WithOpenAPI(path string, info OpenAPIInfo) func(*Option) {
+	return func(o *Option) {
+		o.openAPIPath = path
+		o.openAPIInfo = info
+	}
+}
+
+// WithBaseContext sets the parent of contexts of requests, event streams and
+// WebSocket connections. Cancel ctx on server shutdown to cancel requests in
+// progress and close long-lived connections. Default is context.Background().
+func WithBaseContext(ctx context.Context) func(*Option) {
+	return func(o *Option) {
+		o.baseCtx = ctx
+	}
+}
+
 func WithUrlPrefix(s string) func(*Option) {
 	return func(o *Option) {
 		o.urlPrefix = s
@@ -257,9 +320,15 @@ func (v *Vatel) buildHandlers(mux *router.Router, l *zerolog.Logger) error {
 		logger.Info().Msg("handler registered")
 	}
 
+	v.registerPreflightHandlers(mux, l)
+
 	return nil
 }
 
+// Dater is the interface that wraps methods Parse and Set.
+//
+// Fields of URL query and path parameters implementing Dater (by pointer)
+// are decoded by calling Parse and passing its result to Set.
 type Dater interface {
 	Parse(string) (interface{}, error)
 	Set(interface{})
@@ -0,0 +1,270 @@
+package vatel
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/axkit/errors"
+)
+
+// ErrStaticLoggingLevel is returned on attempt to change endpoint's LogOptions
+// if Vatel was created with option WithStaticLoggingLevel.
+var ErrStaticLoggingLevel = errors.New("logging options are static").Code("VTL-0007").StatusCode(409)
+
+// EndpointLogState describes current logging options of the endpoint.
+type EndpointLogState struct {
+	Method     string     `json:"method"`
+	Path       string     `json:"path"`
+	LogOptions LogOption  `json:"logOptions"`
+	RevertTo   *LogOption `json:"revertTo,omitempty"`
+	RevertAt   *time.Time `json:"revertAt,omitempty"`
+}
+
+// logRevert holds logging options to be restored by timer.
+type logRevert struct {
+	prev  LogOption
+	at    time.Time
+	timer *time.Timer
+}
+
+// logReverts holds pending reverts of endpoints' LogOptions.
+type logReverts struct {
+	mu sync.Mutex
+	m  map[*Endpoint]*logRevert
+}
+
+// LogStates returns logging options of all endpoints.
+func (v *Vatel) LogStates() []EndpointLogState {
+	v.reverts.mu.Lock()
+	defer v.reverts.mu.Unlock()
+
+	res := make([]EndpointLogState, len(v.ep))
+	for i := range v.ep {
+		res[i] = v.logState(&v.ep[i])
+	}
+	return res
+}
+
+func (v *Vatel) logState(e *Endpoint) EndpointLogState {
+	res := EndpointLogState{
+		Method:     e.Method,
+		Path:       e.Path,
+		LogOptions: LogOption(atomic.LoadUint32((*uint32)(&e.LogOptions))),
+	}
+	if r, ok := v.reverts.m[e]; ok {
+		prev, at := r.prev, r.at
+		res.RevertTo, res.RevertAt = &prev, &at
+	}
+	return res
+}
+
+// SetLogOptions sets logging options lo of endpoints matched by method and path pattern.
+// Method "" or "*" matches any method, symbol "*" in pattern matches any sequence
+// of characters (e.g. "/api/customers*").
+//
+// If ttl is positive, previous logging options are restored after ttl.
+// Returns states of matched endpoints.
+func (v *Vatel) SetLogOptions(method, pattern string, lo LogOption, ttl time.Duration) ([]EndpointLogState, error) {
+
+	if v.cfg.staticLoggingLevel {
+		return nil, ErrStaticLoggingLevel.Capture()
+	}
+
+	re, err := pathPatternRegexp(pattern)
+	if err != nil {
+		return nil, errors.ValidationFailed("invalid path pattern").Set("pattern", pattern)
+	}
+
+	v.reverts.mu.Lock()
+	defer v.reverts.mu.Unlock()
+
+	if v.reverts.m == nil {
+		v.reverts.m = make(map[*Endpoint]*logRevert)
+	}
+
+	var res []EndpointLogState
+	for i := range v.ep {
+		e := &v.ep[i]
+		if (method != "" && method != "*" && !strings.EqualFold(method, e.Method)) || !re.MatchString(e.Path) {
+			continue
+		}
+
+		prev := LogOption(atomic.SwapUint32((*uint32)(&e.LogOptions), uint32(lo)))
+
+		// the first changed value is restored even if options were changed several times.
+		if r, ok := v.reverts.m[e]; ok {
+			r.timer.Stop()
+			prev = r.prev
+			delete(v.reverts.m, e)
+		}
+
+		if ttl > 0 {
+			r := &logRevert{prev: prev, at: time.Now().Add(ttl)}
+			r.timer = time.AfterFunc(ttl, func() { v.revertLogOptions(e, r) })
+			v.reverts.m[e] = r
+		}
+		res = append(res, v.logState(e))
+	}
+
+	if len(res) == 0 {
+		return nil, errors.NotFound("no endpoints matched").Set("method", method).Set("pattern", pattern)
+	}
+	return res, nil
+}
+
+func (v *Vatel) revertLogOptions(e *Endpoint, r *logRevert) {
+	v.reverts.mu.Lock()
+	defer v.reverts.mu.Unlock()
+
+	// options were changed again after the timer was started.
+	if v.reverts.m[e] != r {
+		return
+	}
+	atomic.StoreUint32((*uint32)(&e.LogOptions), uint32(r.prev))
+	delete(v.reverts.m, e)
+}
+
+// pathPatternRegexp converts pattern where "*" matches any sequence of characters to regexp.
+func pathPatternRegexp(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+	return regexp.Compile("^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1) + "$")
+}
+
+// Admin provides endpoints managing Vatel at runtime. It's not registered
+// by default and must be added explicitly:
+//
+//	v.Add(v.Admin("/admin/vatel", "VatelAdmin"))
+//
+// Endpoints:
+//
+//	GET {prefix}/log-options - list of endpoints with their LogOptions
+//	PUT {prefix}/log-options - set LogOptions of endpoints matched by path pattern
+//
+// Request body of PUT: {"method": "GET", "path": "/customers*", "logOptions": "full", "ttl": "15m"}.
+type Admin struct {
+	v      *Vatel
+	prefix string
+	perms  []string
+}
+
+// Admin returns admin endpoints with path prefix protected by permissions perms.
+// Admin endpoints must never be public, so they are not compiled if perms is empty.
+func (v *Vatel) Admin(prefix string, perms ...string) *Admin {
+	return &Admin{v: v, prefix: prefix, perms: perms}
+}
+
+// Endpoints implements interface Endpointer.
+func (a *Admin) Endpoints() []Endpoint {
+	return []Endpoint{
+		{
+			Method:     "GET",
+			Path:       path.Join(a.prefix, "log-options"),
+			Perms:      a.perms,
+			internal:   true,
+			check:      a.checkPerms,
+			Controller: func() Handler { return &adminLogStatesController{v: a.v} },
+		},
+		{
+			Method:     "PUT",
+			Path:       path.Join(a.prefix, "log-options"),
+			Perms:      a.perms,
+			internal:   true,
+			check:      a.checkPerms,
+			Controller: func() Handler { return &adminSetLogOptionsController{v: a.v} },
+		},
+	}
+}
+
+// checkPerms returns error if admin endpoints are not protected by permissions.
+func (a *Admin) checkPerms(v *Vatel) error {
+	if len(a.perms) == 0 {
+		return fmt.Errorf("admin endpoints require at least one permission")
+	}
+	return nil
+}
+
+// adminLogState is EndpointLogState with textual logging options (e.g. "exit,reqBody").
+type adminLogState struct {
+	Method     string     `json:"method"`
+	Path       string     `json:"path"`
+	LogOptions string     `json:"logOptions"`
+	RevertTo   *string    `json:"revertTo,omitempty"`
+	RevertAt   *time.Time `json:"revertAt,omitempty"`
+}
+
+func adminLogStates(states []EndpointLogState) []adminLogState {
+	res := make([]adminLogState, len(states))
+	for i, s := range states {
+		res[i] = adminLogState{Method: s.Method, Path: s.Path, LogOptions: s.LogOptions.String(), RevertAt: s.RevertAt}
+		if s.RevertTo != nil {
+			rt := s.RevertTo.String()
+			res[i].RevertTo = &rt
+		}
+	}
+	return res
+}
+
+type adminLogStatesController struct {
+	v   *Vatel
+	res []adminLogState
+}
+
+func (c *adminLogStatesController) Result() interface{} {
+	return &c.res
+}
+
+// Handle implements interface Handler.
+func (c *adminLogStatesController) Handle(ctx Context) error {
+	c.res = adminLogStates(c.v.LogStates())
+	return nil
+}
+
+type adminSetLogOptionsController struct {
+	v  *Vatel
+	in struct {
+		Method     string `json:"method"`
+		Path       string `json:"path" validate:"required"`
+		LogOptions string `json:"logOptions"`
+		TTL        string `json:"ttl"`
+	}
+	res []adminLogState
+}
+
+func (c *adminSetLogOptionsController) Input() interface{} {
+	return &c.in
+}
+
+func (c *adminSetLogOptionsController) Result() interface{} {
+	return &c.res
+}
+
+// Handle implements interface Handler.
+func (c *adminSetLogOptionsController) Handle(ctx Context) error {
+
+	var ttl time.Duration
+	if c.in.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(c.in.TTL); err != nil || ttl < 0 {
+			return validationError([]FieldError{{Field: "ttl", Rule: "duration", Message: "must be a positive duration (e.g. 15m)"}})
+		}
+	}
+
+	lo, err := parseLogOption(c.in.LogOptions)
+	if err != nil {
+		return validationError([]FieldError{{Field: "logOptions", Rule: "logOption", Message: err.Error()}})
+	}
+
+	res, err := c.v.SetLogOptions(c.in.Method, c.in.Path, lo, ttl)
+	if err != nil {
+		return err
+	}
+	c.res = adminLogStates(res)
+	return nil
+}
@@ -0,0 +1,161 @@
+package vatel
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseLogOption(t *testing.T) {
+	lo, err := parseLogOption("fullOnExit, enter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lo != LogFull {
+		t.Errorf("expected %s, got %s", LogFull, lo)
+	}
+	if s := LogFull.String(); s != "enter,exit,reqBody,reqInput,respBody" {
+		t.Errorf("unexpected string: %s", s)
+	}
+	for _, text := range []string{"verbose", "", " , "} {
+		if _, err := parseLogOption(text); err == nil {
+			t.Errorf("%q: error expected", text)
+		}
+	}
+
+	// LogOption is kept numeric in JSON configs.
+	var cfg struct {
+		LogOptions LogOption `json:"logOptions"`
+	}
+	if err := json.Unmarshal([]byte(`{"logOptions":12}`), &cfg); err != nil || cfg.LogOptions != LogExit|LogReqBody {
+		t.Errorf("numeric value expected, got %d %v", cfg.LogOptions, err)
+	}
+}
+
+func TestAdmin_noPerms(t *testing.T) {
+	v := newTestVatel()
+	v.Add(v.Admin("/admin"))
+
+	l := zerolog.Nop()
+	if err := v.BuildHandlers(router.New(), &l); err == nil {
+		t.Error("error expected for admin endpoints without permissions")
+	}
+}
+
+func TestAdmin(t *testing.T) {
+
+	v := newTestVatel()
+	v.Add(v.Admin("/admin", "Admin"), endpoints{
+		{Method: "GET", Path: "/customers/{id}", LogOptions: LogExit, Controller: func() Handler { return &testCustomerController{} }},
+		{Method: "GET", Path: "/customers", LogOptions: LogExit, Controller: func() Handler { return &testSearchController{} }},
+	})
+
+	r := router.New()
+	l := zerolog.Nop()
+	if err := v.BuildHandlers(r, &l); err != nil {
+		t.Fatal(err)
+	}
+
+	var fctx fasthttp.RequestCtx
+	fctx.Request.Header.SetMethod("PUT")
+	fctx.Request.Header.Set("Authorization", "admin")
+	fctx.Request.SetRequestURI("/admin/log-options")
+	fctx.Request.SetBody([]byte(`{"path":"/customers*","logOptions":"full","ttl":"50ms"}`))
+	r.Handler(&fctx)
+
+	var empty fasthttp.RequestCtx
+	empty.Request.Header.SetMethod("PUT")
+	empty.Request.Header.Set("Authorization", "admin")
+	empty.Request.SetRequestURI("/admin/log-options")
+	empty.Request.SetBody([]byte(`{"path":"/customers*","logOptions":""}`))
+	r.Handler(&empty)
+	if empty.Response.StatusCode() != 400 {
+		t.Errorf("400 expected for empty logOptions, got %d %s", empty.Response.StatusCode(), empty.Response.Body())
+	}
+
+	var res []adminLogState
+	if err := json.Unmarshal(fctx.Response.Body(), &res); err != nil {
+		t.Fatalf("%s: %s", err, fctx.Response.Body())
+	}
+	if len(res) != 2 || res[0].LogOptions != LogFull.String() || res[0].RevertTo == nil || *res[0].RevertTo != "exit" {
+		t.Fatalf("unexpected response: %s", fctx.Response.Body())
+	}
+
+	var e *Endpoint
+	for i := range v.ep {
+		if v.ep[i].Path == "/customers" {
+			e = &v.ep[i]
+		}
+	}
+
+	// the second change keeps the original value to be restored.
+	if _, err := v.SetLogOptions("get", "/customers", LogEnter, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.SetLogOptions("", "/customers", LogFull, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if lo := LogOption(atomic.LoadUint32((*uint32)(&e.LogOptions))); lo != LogExit {
+		t.Errorf("expected reverted %s, got %s", LogExit, lo)
+	}
+
+	if _, err := v.SetLogOptions("", "/unknown", LogFull, 0); err == nil {
+		t.Error("error expected for unmatched pattern")
+	}
+
+	fctx.Request.Header.SetMethod("GET")
+	fctx.Response.Reset()
+	r.Handler(&fctx)
+	if !strings.Contains(string(fctx.Response.Body()), `"path":"/customers/{id}","logOptions":"exit"`) {
+		t.Errorf("unexpected response: %s", fctx.Response.Body())
+	}
+}
+
+func TestAdmin_staticLoggingLevel(t *testing.T) {
+	v := NewVatel(WithStaticLoggingLevel())
+	if _, err := v.SetLogOptions("", "*", LogFull, 0); err == nil {
+		t.Error("error expected")
+	}
+}
+
+// TestSetLogOptions_concurrent must be run with -race.
+func TestSetLogOptions_concurrent(t *testing.T) {
+
+	v := newTestVatel()
+	v.Add(endpoints{{Method: "GET", Path: "/customers", LogOptions: LogExit, Controller: func() Handler { return &testSearchController{} }}})
+
+	r := router.New()
+	l := zerolog.Nop()
+	if err := v.BuildHandlers(r, &l); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			var fctx fasthttp.RequestCtx
+			fctx.Request.SetRequestURI("/customers")
+			r.Handler(&fctx)
+		}
+	}()
+
+	for i := 0; i < 500; i++ {
+		lo := LogFull
+		if i%2 == 0 {
+			lo = LogExit
+		}
+		if _, err := v.SetLogOptions("GET", "/customers", lo, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
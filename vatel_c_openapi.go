@@ -0,0 +1,37 @@
+package vatel
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// openAPIController is a controller what generates OpenAPI document
+// describing registered endpoints.
+type openAPIController struct {
+	s *Vatel
+}
+
+// Handle implements interface Handler.
+func (oc *openAPIController) Handle(ctx Context) error {
+
+	doc := oc.s.OpenAPI()
+
+	if string(ctx.RequestCtx().QueryArgs().Peek("format")) == "yaml" || bytes.Contains(ctx.Header("Accept"), []byte("yaml")) {
+		buf, err := doc.MarshalYAML()
+		if err != nil {
+			return err
+		}
+		ctx.SetStatusCode(200).SetContentType([]byte("application/yaml; charset=utf-8"))
+		_, err = ctx.BodyWriter().Write(buf)
+		return err
+	}
+
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	ctx.SetStatusCode(200).SetContentType([]byte("application/json; charset=utf-8"))
+	_, err = ctx.BodyWriter().Write(buf)
+	return err
+}
@@ -0,0 +1,305 @@
+package vatel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"time"
+
+	"github.com/axkit/errors"
+	"github.com/google/uuid"
+)
+
+// CredentialVerifier is the interface what wraps methods VerifyCredentials and UserPayload.
+//
+// VerifyCredentials returns payload of access token if login and password are
+// valid. Returns error with status code 401 otherwise.
+//
+// UserPayload returns actual payload of access token of the user. It's called
+// on refreshing, so changes of user's role and permissions are applied to
+// the new access token. Returns error if the user is blocked or removed.
+type CredentialVerifier interface {
+	VerifyCredentials(ctx context.Context, login, password string) (TokenPayloader, error)
+	UserPayload(ctx context.Context, user uuid.UUID) (TokenPayloader, error)
+}
+
+// TokenPair is the response of login and refresh endpoints.
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// TokenEndpoints provides endpoints issuing and revoking tokens. It's not
+// registered by default and must be added explicitly:
+//
+//	v.Add(v.TokenEndpoints("/auth", issuer, verifier, vatel.NewMemoryRefreshTokenStore()))
+//
+// Endpoints:
+//
+//	POST {prefix}/login   - {"login": "john", "password": "secret"} returns TokenPair
+//	POST {prefix}/refresh - {"refreshToken": "..."} returns TokenPair with new refresh token
+//	POST {prefix}/logout  - revokes access token of the request and refresh token {"refreshToken": "..."}
+//
+// Refresh token is rotated on every refresh. If already used refresh token is
+// presented again, all tokens of its chain are revoked. Access token is
+// revoked on logout, so RevokeTokenChecker set by SetRevokeTokenChecker must
+// implement TokenRevoker (e.g. MemoryRevokedTokenStore), otherwise endpoints
+// are not compiled.
+//
+// Request and response bodies are never logged.
+type TokenEndpoints struct {
+	v      *Vatel
+	prefix string
+	ti     TokenIssuer
+	cv     CredentialVerifier
+	rts    RefreshTokenStore
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// TokenEndpoints returns token endpoints with path prefix.
+func (v *Vatel) TokenEndpoints(prefix string, ti TokenIssuer, cv CredentialVerifier, rts RefreshTokenStore) *TokenEndpoints {
+	return &TokenEndpoints{v: v, prefix: prefix, ti: ti, cv: cv, rts: rts, ttl: DefaultRefreshTokenTTL, now: time.Now}
+}
+
+// SetRefreshTokenTTL sets lifetime of refresh tokens. Default is DefaultRefreshTokenTTL.
+func (te *TokenEndpoints) SetRefreshTokenTTL(d time.Duration) {
+	te.ttl = d
+}
+
+// Endpoints implements interface Endpointer.
+func (te *TokenEndpoints) Endpoints() []Endpoint {
+	return []Endpoint{
+		{
+			Method:            "POST",
+			Path:              path.Join(te.prefix, "login"),
+			LogOptions:        LogExit,
+			NoInputLog:        true,
+			NoResultLog:       true,
+			SuccessStatusCode: 200,
+			Controller:        func() Handler { return &loginController{te: te} },
+		},
+		{
+			Method:            "POST",
+			Path:              path.Join(te.prefix, "refresh"),
+			LogOptions:        LogExit,
+			NoInputLog:        true,
+			NoResultLog:       true,
+			SuccessStatusCode: 200,
+			Controller:        func() Handler { return &refreshController{te: te} },
+		},
+		{
+			Method:      "POST",
+			Path:        path.Join(te.prefix, "logout"),
+			LogOptions:  LogExit,
+			NoInputLog:  true,
+			NoResultLog: true,
+			Controller:  func() Handler { return &logoutController{te: te} },
+			check:       checkTokenRevoker,
+		},
+	}
+}
+
+// checkTokenRevoker returns error if logout can not revoke access tokens.
+func checkTokenRevoker(v *Vatel) error {
+	if _, ok := v.rtc.(TokenRevoker); !ok {
+		return fmt.Errorf("RevokeTokenChecker set by SetRevokeTokenChecker must implement TokenRevoker")
+	}
+	if v.td == nil {
+		return fmt.Errorf("TokenDecoder is not set by SetTokenDecoder")
+	}
+	return nil
+}
+
+// issue returns new access token and refresh token of the family. The family
+// is started if family is empty.
+func (te *TokenEndpoints) issue(p TokenPayloader, family string) (*TokenPair, error) {
+
+	at, exp, err := te.ti.IssueToken(p)
+	if err != nil {
+		return nil, err
+	}
+
+	rt, id, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	if family == "" {
+		family = id
+	}
+
+	now := te.now()
+	if err := te.rts.Save(RefreshToken{ID: id, Family: family, User: p.User(), ExpiresAt: now.Add(te.ttl)}); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  at,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(math.Ceil(exp.Sub(now).Seconds())),
+		RefreshToken: rt,
+	}, nil
+}
+
+type loginController struct {
+	te *TokenEndpoints
+	in struct {
+		Login    string `json:"login" validate:"required"`
+		Password string `json:"password" validate:"required"`
+	}
+	res *TokenPair
+}
+
+func (c *loginController) Input() interface{} {
+	return &c.in
+}
+
+func (c *loginController) Result() interface{} {
+	return &c.res
+}
+
+// Handle implements interface Handler.
+func (c *loginController) Handle(ctx Context) error {
+	p, err := c.te.cv.VerifyCredentials(ctx.Context(), c.in.Login, c.in.Password)
+	if err != nil {
+		return err
+	}
+	ctx.SetTokenPayload(p)
+
+	c.res, err = c.te.issue(p, "")
+	return err
+}
+
+type refreshController struct {
+	te *TokenEndpoints
+	in struct {
+		RefreshToken string `json:"refreshToken" validate:"required"`
+	}
+	res *TokenPair
+}
+
+func (c *refreshController) Input() interface{} {
+	return &c.in
+}
+
+func (c *refreshController) Result() interface{} {
+	return &c.res
+}
+
+// Handle implements interface Handler.
+func (c *refreshController) Handle(ctx Context) error {
+
+	rt, found, used, err := c.te.rts.Use(refreshTokenID(c.in.RefreshToken))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrRefreshTokenInvalid.Capture()
+	}
+	if used {
+		// the token was stolen or the client is broken, the chain is not trusted anymore.
+		if err := c.te.rts.RevokeFamily(rt.Family); err != nil {
+			return err
+		}
+		return ErrRefreshTokenReused.Capture()
+	}
+
+	p, err := c.te.cv.UserPayload(ctx.Context(), rt.User)
+	if err != nil {
+		return err
+	}
+	ctx.SetTokenPayload(p)
+
+	c.res, err = c.te.issue(p, rt.Family)
+	return err
+}
+
+type logoutController struct {
+	te *TokenEndpoints
+}
+
+// Handle implements interface Handler. Revokes access token of the request
+// and refresh token passed in optional request body.
+func (c *logoutController) Handle(ctx Context) error {
+
+	var in struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if body := ctx.RequestCtx().PostBody(); len(body) > 0 {
+		if err := json.Unmarshal(body, &in); err != nil {
+			return errors.InvalidRequestBody(err.Error())
+		}
+	}
+
+	if in.RefreshToken != "" {
+		rt, found, _, err := c.te.rts.Use(refreshTokenID(in.RefreshToken))
+		if err != nil {
+			return err
+		}
+		if found {
+			if err := c.te.rts.RevokeFamily(rt.Family); err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.revokeAccessToken(ctx)
+}
+
+// revokeAccessToken registers access token of the request as revoked. Invalid
+// and expired tokens are ignored.
+func (c *logoutController) revokeAccessToken(ctx Context) error {
+
+	v := c.te.v
+	tr := v.rtc.(TokenRevoker)
+
+	te := v.te
+	if te == nil {
+		te = defaultTokenExtractor
+	}
+	at, _ := te.ExtractToken(ctx.RequestCtx())
+	if len(at) == 0 {
+		return nil
+	}
+
+	token, err := v.td.Decode(at)
+	if err != nil {
+		return nil
+	}
+	ctx.SetTokenPayload(token.ApplicationPayload())
+
+	exp, ok := tokenExpiration(token)
+	if !ok {
+		// access tokens do not live longer than refresh tokens.
+		exp = c.te.now().Add(c.te.ttl)
+	}
+	return tr.RevokeToken(string(at), exp)
+}
+
+// tokenExpiration returns value of claim exp of the token.
+func tokenExpiration(t Tokener) (time.Time, bool) {
+	var sec float64
+	switch v := t.SystemPayload()["exp"].(type) {
+	case time.Time:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		sec = f
+	case float64:
+		sec = v
+	case int64:
+		sec = float64(v)
+	case int:
+		sec = float64(v)
+	default:
+		return time.Time{}, false
+	}
+	return time.Unix(int64(math.Ceil(sec)), 0), true
+}
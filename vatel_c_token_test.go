@@ -0,0 +1,164 @@
+package vatel
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axkit/errors"
+	"github.com/fasthttp/router"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+// testIssuer issues tokens decoded by testAuth: token is the login.
+type testIssuer struct{}
+
+func (ti *testIssuer) IssueToken(p TokenPayloader) (string, time.Time, error) {
+	return p.Login(), time.Now().Add(5 * time.Minute), nil
+}
+
+type testVerifier struct {
+	users map[string]uuid.UUID
+	role  int
+}
+
+func (cv *testVerifier) VerifyCredentials(ctx context.Context, login, password string) (TokenPayloader, error) {
+	if u, ok := cv.users[login]; ok && password == "secret" {
+		return &testPayload{user: u, login: login, role: cv.role}, nil
+	}
+	return nil, errors.New("invalid credentials").StatusCode(401)
+}
+
+func (cv *testVerifier) UserPayload(ctx context.Context, user uuid.UUID) (TokenPayloader, error) {
+	for login, u := range cv.users {
+		if u == user {
+			return &testPayload{user: u, login: login, role: cv.role}, nil
+		}
+	}
+	return nil, errors.NotFound("user not found")
+}
+
+func TestTokenEndpoints(t *testing.T) {
+
+	user := uuid.New()
+	cv := testVerifier{users: map[string]uuid.UUID{"john": user}, role: 2}
+	ts := NewMemoryRevokedTokenStore()
+
+	v := newTestVatel()
+	v.SetRevokeTokenChecker(ts)
+	v.SetTokenExtractor(AuthorizationToken("Bearer"))
+	v.Add(v.TokenEndpoints("/auth", &testIssuer{}, &cv, NewMemoryRefreshTokenStore()), endpoints{
+		{Method: "GET", Path: "/whoami", Perms: []string{"WhoAmI"}, Controller: func() Handler { return &testWhoAmIController{} }},
+	})
+
+	var buf strings.Builder
+	r := router.New()
+	l := zerolog.New(&buf)
+	if err := v.BuildHandlers(r, &l); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(method, uri, at, body string) (int, []byte) {
+		var fctx fasthttp.RequestCtx
+		fctx.Request.Header.SetMethod(method)
+		fctx.Request.SetRequestURI(uri)
+		if at != "" {
+			fctx.Request.Header.Set("Authorization", "Bearer "+at)
+		}
+		if body != "" {
+			fctx.Request.SetBody([]byte(body))
+		}
+		r.Handler(&fctx)
+		return fctx.Response.StatusCode(), fctx.Response.Body()
+	}
+
+	pair := func(body []byte) TokenPair {
+		var tp TokenPair
+		if err := json.Unmarshal(body, &tp); err != nil {
+			t.Fatalf("%s: %s", err, body)
+		}
+		return tp
+	}
+
+	if sc, body := call("POST", "/auth/login", "", `{"login":"john","password":"wrong"}`); sc != 401 {
+		t.Errorf("401 expected for invalid credentials, got %d %s", sc, body)
+	}
+
+	sc, body := call("POST", "/auth/login", "", `{"login":"john","password":"secret"}`)
+	if sc != 200 {
+		t.Fatalf("login failed: %d %s", sc, body)
+	}
+	tp1 := pair(body)
+	if tp1.AccessToken != "john" || tp1.TokenType != "Bearer" || tp1.ExpiresIn != 300 || tp1.RefreshToken == "" {
+		t.Errorf("unexpected token pair %+v", tp1)
+	}
+
+	// refresh token is rotated.
+	sc, body = call("POST", "/auth/refresh", "", `{"refreshToken":"`+tp1.RefreshToken+`"}`)
+	if sc != 200 {
+		t.Fatalf("refresh failed: %d %s", sc, body)
+	}
+	tp2 := pair(body)
+	if tp2.RefreshToken == tp1.RefreshToken || tp2.AccessToken != "john" {
+		t.Errorf("unexpected token pair %+v", tp2)
+	}
+
+	// reuse of the rotated token revokes the chain.
+	if sc, body := call("POST", "/auth/refresh", "", `{"refreshToken":"`+tp1.RefreshToken+`"}`); sc != 401 || !strings.Contains(string(body), "VTL-0021") {
+		t.Errorf("reuse must be detected, got %d %s", sc, body)
+	}
+	if sc, body := call("POST", "/auth/refresh", "", `{"refreshToken":"`+tp2.RefreshToken+`"}`); sc != 401 || !strings.Contains(string(body), "VTL-0020") {
+		t.Errorf("chain must be revoked after reuse, got %d %s", sc, body)
+	}
+
+	if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), tp1.RefreshToken) {
+		t.Errorf("credentials must not be logged: %s", buf.String())
+	}
+
+	// logout revokes access token and refresh token.
+	_, body = call("POST", "/auth/login", "", `{"login":"john","password":"secret"}`)
+	tp3 := pair(body)
+	if sc, _ := call("GET", "/whoami", tp3.AccessToken, ""); sc != 200 {
+		t.Fatalf("access token rejected before logout: %d", sc)
+	}
+
+	if sc, body := call("POST", "/auth/logout", tp3.AccessToken, `{"refreshToken":"`+tp3.RefreshToken+`"}`); sc != 204 {
+		t.Fatalf("logout failed: %d %s", sc, body)
+	}
+	if exp, ok := ts.revoked["john"]; !ok || exp.Before(time.Now()) {
+		t.Errorf("access token must be revoked, got %v", ts.revoked)
+	}
+	if sc, _ := call("GET", "/whoami", tp3.AccessToken, ""); sc != 401 {
+		t.Errorf("revoked access token accepted: %d", sc)
+	}
+	if sc, _ := call("POST", "/auth/refresh", "", `{"refreshToken":"`+tp3.RefreshToken+`"}`); sc != 401 {
+		t.Errorf("refresh token accepted after logout: %d", sc)
+	}
+
+	if sc, body := call("POST", "/auth/logout", "", ""); sc != 204 {
+		t.Errorf("logout without tokens must succeed, got %d %s", sc, body)
+	}
+}
+
+type testRevokeChecker struct{}
+
+func (testRevokeChecker) IsTokenRevoked(string) (bool, error) { return false, nil }
+
+func TestTokenEndpoints_noRevoker(t *testing.T) {
+
+	cv := testVerifier{users: map[string]uuid.UUID{"john": uuid.New()}}
+
+	v := newTestVatel()
+	v.SetRevokeTokenChecker(testRevokeChecker{})
+	v.Add(v.TokenEndpoints("/auth", &testIssuer{}, &cv, NewMemoryRefreshTokenStore()))
+
+	l := zerolog.Nop()
+	err := v.BuildHandlers(router.New(), &l)
+	if err == nil || !strings.Contains(err.Error(), "/auth/logout") {
+		t.Errorf("logout without TokenRevoker must not be compiled, got %v", err)
+	}
+}
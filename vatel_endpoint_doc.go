@@ -1,24 +1,306 @@
 package vatel
 
-// endpointController is a controller what generates
-// endpoint's documentation as HTML page.
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"reflect"
+	"time"
 
-// Handle implements interface Handler.
+	"github.com/axkit/date"
+)
+
+// EndpointDescription describes endpoint's input and output parameters.
+// It's returned by endpoint if request has URL query parameter description=true.
+type EndpointDescription struct {
+	Method              string             `json:"method"`
+	Path                string             `json:"path"`
+	Perms               []string           `json:"perms,omitempty"`
+	RequestContentType  string             `json:"requestContentType,omitempty"`
+	ResponseContentType string             `json:"responseContentType"`
+	PathParams          []FieldDescription `json:"pathParams,omitempty"`
+	QueryParams         []FieldDescription `json:"queryParams,omitempty"`
+	Body                *Schema            `json:"body,omitempty"`
+	BodyFields          []FieldDescription `json:"-"`
+	BodyExample         json.RawMessage    `json:"bodyExample,omitempty"`
+	Result              *Schema            `json:"result,omitempty"`
+	ResultFields        []FieldDescription `json:"-"`
+	ResultExample       json.RawMessage    `json:"resultExample,omitempty"`
+}
+
+// FieldDescription describes a single parameter or attribute of JSON document.
+type FieldDescription struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+	Mask     string `json:"mask,omitempty"`
+}
+
+// endpointDocumentation returns function what writes endpoint's documentation
+// as HTML page or as JSON if header Accept mentions application/json.
 func endpointDocumentation(e *Endpoint) func(ctx Context) error {
-	return func(Context) error {
+	return func(ctx Context) error {
+
+		d := e.description()
+
+		if bytes.Contains(ctx.Header("Accept"), []byte("application/json")) {
+			buf, err := json.Marshal(d)
+			if err != nil {
+				return err
+			}
+			ctx.SetStatusCode(200).SetContentType([]byte("application/json; charset=utf-8"))
+			_, err = ctx.BodyWriter().Write(buf)
+			return err
+		}
+
+		ctx.SetStatusCode(200).SetContentType([]byte("text/html; charset=utf-8"))
+		return descriptionTemplate.Execute(ctx.BodyWriter(), d)
+	}
+}
+
+// description builds endpoint description by reflecting controller's
+// Param, Input and Result structs.
+func (e *Endpoint) description() *EndpointDescription {
+
+	d := EndpointDescription{
+		Method:              e.Method,
+		Path:                e.Path,
+		Perms:               e.Perms,
+		ResponseContentType: e.ResponseContentType,
+	}
+
+	if d.ResponseContentType == "" {
+		d.ResponseContentType = "application/json; charset=utf-8"
+	}
+
+	sg := newSchemaGenerator(false)
+	c := e.Controller()
+
+	var pt reflect.Type
+	if p, ok := c.(Paramer); ok {
+		pt = reflect.TypeOf(p.Param())
+	}
+
+	for _, name := range pathParams(e.Path) {
+		fd := FieldDescription{Name: name, Type: "string", Required: true}
+		if f, ok := pathParamField(pt, name); ok {
+			fd.Type = schemaTypeName(sg.schema(f.Type))
+			fd.Mask = f.Tag.Get("mask")
+		}
+		d.PathParams = append(d.PathParams, fd)
+	}
+
+	if in, ok := c.(Inputer); ok {
+		switch e.Method {
+		case "GET", "DELETE":
+			for _, f := range paramFields(reflect.TypeOf(in.Input())) {
+				fs := sg.schema(f.Type)
+				d.QueryParams = append(d.QueryParams, FieldDescription{
+					Name:     f.Tag.Get("param"),
+					Type:     schemaTypeName(fs),
+					Required: fs.applyValidationRules(f.Tag.Get("validate")),
+					Mask:     f.Tag.Get("mask"),
+				})
+			}
+		default:
+			it := reflect.TypeOf(in.Input())
+			if hasFormTags(it) {
+				// multipart form has no JSON example.
+				d.RequestContentType = "multipart/form-data"
+				d.Body = sg.formSchema(it)
+				d.BodyFields = schemaFields("", d.Body, nil)
+				break
+			}
+			d.Body = sg.schemaOf(in.Input())
+			if d.Body != nil {
+				d.RequestContentType = "application/json"
+			}
+			d.BodyFields = schemaFields("", d.Body, nil)
+			d.BodyExample = example(it)
+		}
+	}
+
+	if r, ok := c.(Resulter); ok {
+		d.Result = sg.schemaOf(r.Result())
+		d.ResultFields = schemaFields("", d.Result, nil)
+		d.ResultExample = example(reflect.TypeOf(r.Result()))
+	}
+
+	return &d
+}
+
+// schemaFields flattens object's properties to the list of fields
+// with dotted names. Attributes of array items have suffix "[]".
+func schemaFields(prefix string, s *Schema, res []FieldDescription) []FieldDescription {
+	if s == nil {
+		return res
+	}
+
+	if s.Type == "array" {
+		return schemaFields(prefix+"[]", s.Items, res)
+	}
+
+	if prefix != "" {
+		prefix += "."
+	}
+
+	for _, name := range s.PropertyNames() {
+		ps := s.Properties[name]
+		res = append(res, FieldDescription{
+			Name:     prefix + name,
+			Type:     schemaTypeName(ps),
+			Required: isRequired(s, name),
+			Mask:     ps.Mask,
+		})
 
-		// res := "<html><body>"
-		// for i := range r {
-		// 	res += fmt.Sprintf("%s %s<br>", r[i].Method, r[i].Path)
-		// }
+		for ps.Type == "array" {
+			ps = ps.Items
+		}
+		if len(ps.Properties) > 0 {
+			res = schemaFields(res[len(res)-1].Name+arraySuffix(s.Properties[name]), ps, res)
+		}
+	}
+	return res
+}
+
+func arraySuffix(s *Schema) string {
+	res := ""
+	for s.Type == "array" {
+		res += "[]"
+		s = s.Items
+	}
+	return res
+}
+
+func isRequired(s *Schema, name string) bool {
+	for i := range s.Required {
+		if s.Required[i] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaTypeName returns short human readable type name of the schema.
+func schemaTypeName(s *Schema) string {
+	switch {
+	case s == nil, s.Type == "" && s.Ref == "":
+		return "any"
+	case s.Type == "array":
+		return "[]" + schemaTypeName(s.Items)
+	case s.Type == "object" && s.AdditionalProperties != nil:
+		return "map[string]" + schemaTypeName(s.AdditionalProperties)
+	case s.Format != "":
+		return s.Type + " (" + s.Format + ")"
+	}
+	return s.Type
+}
 
-		// res += "</body></html>"
-		// ctx.Response.SetStatusCode(fasthttp.StatusOK)
-		// ctx.SetContentType("text/html; charset=utf-8")
-		// if _, err := ctx.WriteString(res); err != nil {
-		// 	return err
-		// }
+// exampleMaxDepth limits nesting of generated examples for recursive types.
+const exampleMaxDepth = 5
 
+// example returns JSON example of the type t. Structs are populated
+// with sample values, slices and maps get a single element.
+// Returns nil if t is nil.
+func example(t reflect.Type) json.RawMessage {
+	if t == nil {
 		return nil
 	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	v := reflect.New(t).Elem()
+	fillExample(v, 0)
+
+	buf, err := json.MarshalIndent(v.Interface(), "", "  ")
+	if err != nil {
+		return nil
+	}
+	return buf
+}
+
+func fillExample(v reflect.Value, depth int) {
+
+	if depth > exampleMaxDepth || !v.CanSet() {
+		return
+	}
+
+	switch v.Type() {
+	case timeType:
+		v.Set(reflect.ValueOf(time.Date(2021, 9, 1, 10, 0, 0, 0, time.UTC)))
+		return
+	case dateType:
+		v.Set(reflect.ValueOf(date.New(2021, 9, 1)))
+		return
+	case uuidType, durationType:
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1.5)
+	case reflect.String:
+		v.SetString("string")
+	case reflect.Ptr:
+		if depth < exampleMaxDepth {
+			v.Set(reflect.New(v.Type().Elem()))
+			fillExample(v.Elem(), depth+1)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			fillExample(v.Field(i), depth+1)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fillExample(v.Index(0), depth+1)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fillExample(v.Index(i), depth+1)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		m := reflect.MakeMap(v.Type())
+		ev := reflect.New(v.Type().Elem()).Elem()
+		fillExample(ev, depth+1)
+		m.SetMapIndex(reflect.ValueOf("key").Convert(v.Type().Key()), ev)
+		v.Set(m)
+	}
 }
+
+var descriptionTemplate = template.Must(template.New("description").Parse(`<html>
+<head><title>{{.Method}} {{.Path}}</title></head>
+<body>
+<h2>{{.Method}} {{.Path}}</h2>
+{{if .Perms}}<p>Required permissions: {{range $i, $p := .Perms}}{{if $i}}, {{end}}<code>{{$p}}</code>{{end}}</p>
+{{else}}<p>Public endpoint</p>
+{{end}}
+{{define "fields"}}<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Name</th><th>Type</th><th>Required</th><th>Mask</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{if .Required}}yes{{end}}</td><td>{{.Mask}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .PathParams}}<h3>Path parameters</h3>
+{{template "fields" .PathParams}}{{end}}
+{{if .QueryParams}}<h3>Query parameters</h3>
+{{template "fields" .QueryParams}}{{end}}
+{{if .Body}}<h3>Request body ({{.RequestContentType}})</h3>
+{{template "fields" .BodyFields}}{{if .BodyExample}}<h4>Example</h4>
+<pre>{{printf "%s" .BodyExample}}</pre>{{end}}{{end}}
+{{if .Result}}<h3>Response body ({{.ResponseContentType}})</h3>
+{{template "fields" .ResultFields}}<h4>Example</h4>
+<pre>{{printf "%s" .ResultExample}}</pre>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,613 @@
+package vatel
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/axkit/errors"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+)
+
+// Default values of WebSocketOptions.
+const (
+	DefaultWSPingInterval        = 30 * time.Second
+	DefaultWSIdleTimeout         = 60 * time.Second
+	DefaultWSRevokeCheckInterval = time.Minute
+	DefaultWSMaxMessageSize      = 1 << 20
+)
+
+// WebSocket close status codes (RFC 6455, section 7.4.1).
+const (
+	WSCloseNormal          = 1000
+	WSCloseGoingAway       = 1001
+	WSCloseProtocolError   = 1002
+	WSCloseUnsupportedData = 1003
+	WSCloseNoStatus        = 1005
+	WSCloseInvalidPayload  = 1007
+	WSClosePolicyViolation = 1008
+	WSCloseMessageTooBig   = 1009
+	WSCloseInternalError   = 1011
+)
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+
+	wsWriteTimeout = 10 * time.Second
+	wsCloseTimeout = time.Second
+	wsGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var (
+	ErrWebSocketUpgradeRequired = errors.New("websocket handshake expected").Code("VTL-0011").StatusCode(426)
+	ErrWebSocketOriginForbidden = errors.New("websocket origin not allowed").Code("VTL-0022").StatusCode(403)
+
+	// ErrWebSocketClosed is returned by WSConn.Send after the close frame was sent.
+	ErrWebSocketClosed = errors.New("websocket connection closed")
+)
+
+// WebSocketOptions defines keep-alive and limits of WebSocket connections.
+// Zero values are replaced by defaults.
+type WebSocketOptions struct {
+	// PingInterval is the period of sending ping frames to the client.
+	PingInterval time.Duration
+
+	// IdleTimeout is the maximum period without any frame (including pong)
+	// from the client. Connection is closed if it's exceeded.
+	IdleTimeout time.Duration
+
+	// RevokeCheckInterval is the period of checking connection's access token
+	// by RevokeTokenChecker. Connection is closed with status 1008 if the
+	// token was revoked.
+	RevokeCheckInterval time.Duration
+
+	// MaxMessageSize is the maximum size of a message in bytes.
+	MaxMessageSize int
+
+	// AllowedOrigins is the list of origins allowed to open connections. The format
+	// is the same as CORSPolicy.AllowedOrigins. If empty, origins allowed by
+	// endpoint's CORS policy are accepted, or only the same origin if there is no
+	// CORS policy. Handshake without header Origin (non-browser client) is accepted.
+	AllowedOrigins []string
+}
+
+func (o WebSocketOptions) withDefaults() WebSocketOptions {
+	if o.PingInterval <= 0 {
+		o.PingInterval = DefaultWSPingInterval
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = DefaultWSIdleTimeout
+	}
+	if o.RevokeCheckInterval <= 0 {
+		o.RevokeCheckInterval = DefaultWSRevokeCheckInterval
+	}
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = DefaultWSMaxMessageSize
+	}
+	return o
+}
+
+// MessageHandler is the interface what wraps methods Message and HandleMessage.
+//
+// If endpoint's controller implements MessageHandler, endpoint accepts WebSocket
+// connections. Handle is called once before the connection upgrade and can
+// reject it by returning error.
+//
+// Message returns reference to the object what will be promoted with JSON text
+// message. A new object of the same type is created for every message, values
+// are validated like Inputer's ones.
+//
+// HandleMessage is called for every received message. Returned error is sent
+// to the client as JSON text message, the connection stays open.
+type MessageHandler interface {
+	Message() interface{}
+	HandleMessage(conn *WSConn, msg interface{}) error
+}
+
+// wsCloseError is the reason of closing WebSocket connection.
+type wsCloseError struct {
+	code   uint16
+	reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return "websocket closed with status " + strconv.Itoa(int(e.code)) + " " + e.reason
+}
+
+// WSConn is the WebSocket connection.
+type WSConn struct {
+	nc   net.Conn
+	br   *bufio.Reader
+	opts WebSocketOptions
+
+	tp TokenPayloader
+	at string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	closeSent   bool
+	closeStatus wsCloseError
+}
+
+// TokenPayload returns payload of the access token what authorized the connection.
+// Returns nil if endpoint has no Perms.
+func (c *WSConn) TokenPayload() TokenPayloader {
+	return c.tp
+}
+
+// Context returns context what is cancelled when the connection is closing.
+func (c *WSConn) Context() context.Context {
+	return c.ctx
+}
+
+// RemoteAddr returns client's network address.
+func (c *WSConn) RemoteAddr() net.Addr {
+	return c.nc.RemoteAddr()
+}
+
+// Send sends msg encoded to JSON as text message.
+func (c *WSConn) Send(msg interface{}) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(wsText, buf)
+}
+
+// Close closes the connection with status 1000.
+func (c *WSConn) Close() error {
+	return c.close(WSCloseNormal, "")
+}
+
+// close sends close frame and waits wsCloseTimeout for client's close frame.
+func (c *WSConn) close(code uint16, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload = append(payload, reason...)
+
+	c.mu.Lock()
+	if !c.closeSent {
+		c.closeStatus = wsCloseError{code, reason}
+	}
+	c.mu.Unlock()
+
+	err := c.writeFrame(wsClose, payload)
+	c.cancel()
+	c.nc.SetReadDeadline(time.Now().Add(wsCloseTimeout))
+	return err
+}
+
+// writeFrame writes a single unmasked frame. Nothing can be sent after close frame.
+func (c *WSConn) writeFrame(opcode byte, payload []byte) error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closeSent {
+		return ErrWebSocketClosed
+	}
+
+	buf := make([]byte, 0, 10+len(payload))
+	buf = append(buf, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, byte(n))
+	case n <= 0xffff:
+		buf = append(buf, 126, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(buf[2:], uint64(n))
+	}
+	buf = append(buf, payload...)
+
+	if opcode == wsClose {
+		c.closeSent = true
+	}
+
+	c.nc.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := c.nc.Write(buf)
+	return err
+}
+
+// readFrame reads a single frame. Client's frames must be masked.
+func (c *WSConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+
+	var h [8]byte
+	if _, err = io.ReadFull(c.br, h[:2]); err != nil {
+		return
+	}
+
+	fin = h[0]&0x80 != 0
+	opcode = h[0] & 0x0f
+
+	if h[0]&0x70 != 0 {
+		return fin, opcode, nil, &wsCloseError{WSCloseProtocolError, "reserved bits are set"}
+	}
+	if h[1]&0x80 == 0 {
+		return fin, opcode, nil, &wsCloseError{WSCloseProtocolError, "frame is not masked"}
+	}
+
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		if _, err = io.ReadFull(c.br, h[:2]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(h[:2]))
+	case 127:
+		if _, err = io.ReadFull(c.br, h[:8]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(h[:8])
+	}
+
+	if opcode >= wsClose && (!fin || n > 125) {
+		return fin, opcode, nil, &wsCloseError{WSCloseProtocolError, "invalid control frame"}
+	}
+	if n > uint64(c.opts.MaxMessageSize) {
+		return fin, opcode, nil, &wsCloseError{WSCloseMessageTooBig, "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// isValidWSCloseCode returns true if status code can be sent in close frame
+// (RFC 6455, section 7.4). Codes 1005, 1006 and 1015 are reserved for reporting
+// and must not be sent.
+func isValidWSCloseCode(code uint16) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// readMessage returns the next text or binary message assembled from frames.
+// Control frames are processed inside.
+func (c *WSConn) readMessage() (opcode byte, msg []byte, err error) {
+
+	for {
+		c.nc.SetReadDeadline(time.Now().Add(c.opts.IdleTimeout))
+
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsPing:
+			c.writeFrame(wsPong, payload)
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			// close frame without status code is answered with 1000.
+			ce := wsCloseError{code: WSCloseNormal}
+			switch {
+			case len(payload) == 1:
+				ce = wsCloseError{WSCloseProtocolError, "invalid close frame"}
+			case len(payload) >= 2:
+				ce.code = binary.BigEndian.Uint16(payload)
+				ce.reason = string(payload[2:])
+				if !isValidWSCloseCode(ce.code) {
+					ce = wsCloseError{WSCloseProtocolError, "invalid close status code"}
+				} else if !utf8.ValidString(ce.reason) {
+					ce = wsCloseError{WSCloseInvalidPayload, "invalid UTF-8"}
+				}
+			}
+			return 0, nil, &ce
+		case wsText, wsBinary:
+			if opcode != 0 {
+				return 0, nil, &wsCloseError{WSCloseProtocolError, "continuation frame expected"}
+			}
+			opcode, msg = op, payload
+		case wsContinuation:
+			if opcode == 0 {
+				return 0, nil, &wsCloseError{WSCloseProtocolError, "unexpected continuation frame"}
+			}
+			msg = append(msg, payload...)
+		default:
+			return 0, nil, &wsCloseError{WSCloseProtocolError, "unknown opcode"}
+		}
+
+		if len(msg) > c.opts.MaxMessageSize {
+			return 0, nil, &wsCloseError{WSCloseMessageTooBig, "message too big"}
+		}
+
+		if fin {
+			if opcode == wsText && !utf8.Valid(msg) {
+				return 0, nil, &wsCloseError{WSCloseInvalidPayload, "invalid UTF-8"}
+			}
+			return opcode, msg, nil
+		}
+	}
+}
+
+// wsRegistry holds open WebSocket connections grouped by user.
+type wsRegistry struct {
+	mu    sync.RWMutex
+	conns map[uuid.UUID]map[*WSConn]struct{}
+}
+
+func (r *wsRegistry) add(c *WSConn, user uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conns == nil {
+		r.conns = make(map[uuid.UUID]map[*WSConn]struct{})
+	}
+	if r.conns[user] == nil {
+		r.conns[user] = make(map[*WSConn]struct{})
+	}
+	r.conns[user][c] = struct{}{}
+}
+
+func (r *wsRegistry) remove(c *WSConn, user uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns[user], c)
+	if len(r.conns[user]) == 0 {
+		delete(r.conns, user)
+	}
+}
+
+func (r *wsRegistry) list(user uuid.UUID) []*WSConn {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make([]*WSConn, 0, len(r.conns[user]))
+	for c := range r.conns[user] {
+		res = append(res, c)
+	}
+	return res
+}
+
+// Broadcast sends msg encoded to JSON to all open WebSocket connections
+// of the user. Connections of endpoints without Perms belong to uuid.Nil.
+// Returns number of connections the message was sent to.
+func (v *Vatel) Broadcast(user uuid.UUID, msg interface{}) (int, error) {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, c := range v.ws.list(user) {
+		if c.writeFrame(wsText, buf) == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// WebSocketConns returns open WebSocket connections of the user.
+func (v *Vatel) WebSocketConns(user uuid.UUID) []*WSConn {
+	return v.ws.list(user)
+}
+
+// headerHasToken returns true if comma separated header value contains token.
+func headerHasToken(hv []byte, token string) bool {
+	for _, s := range strings.Split(string(hv), ",") {
+		if strings.EqualFold(strings.TrimSpace(s), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWebSocketHandshake validates client's opening handshake.
+func checkWebSocketHandshake(fctx *fasthttp.RequestCtx) error {
+	h := &fctx.Request.Header
+	key, err := base64.StdEncoding.DecodeString(string(h.Peek("Sec-WebSocket-Key")))
+	if !fctx.IsGet() ||
+		!headerHasToken(h.Peek("Connection"), "upgrade") ||
+		!headerHasToken(h.Peek("Upgrade"), "websocket") ||
+		string(h.Peek("Sec-WebSocket-Version")) != "13" ||
+		err != nil || len(key) != 16 {
+		fctx.Response.Header.Set("Sec-WebSocket-Version", "13")
+		return ErrWebSocketUpgradeRequired.Capture()
+	}
+	return nil
+}
+
+// isWebSocketOriginAllowed returns true if header Origin of the handshake is
+// allowed by WebSocketOptions.AllowedOrigins, endpoint's CORS policy or matches
+// the host of the request. It protects cookie authenticated connections from
+// cross-site WebSocket hijacking.
+func (e *Endpoint) isWebSocketOriginAllowed(fctx *fasthttp.RequestCtx) bool {
+	origin := string(fctx.Request.Header.Peek("Origin"))
+	if origin == "" {
+		return true
+	}
+
+	switch {
+	case len(e.WebSocket.AllowedOrigins) > 0:
+		return (&CORSPolicy{AllowedOrigins: e.WebSocket.AllowedOrigins}).isOriginAllowed(origin)
+	case e.cors != nil:
+		return e.cors.isOriginAllowed(origin)
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, string(fctx.Host()))
+}
+
+// wsAcceptKey returns value of response header Sec-WebSocket-Accept.
+func wsAcceptKey(key []byte) string {
+	h := sha1.New()
+	h.Write(key)
+	h.Write([]byte(wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// upgradeWebSocket completes the handshake. Messages are served after
+// the request handler returns.
+func (e *Endpoint) upgradeWebSocket(ctx Context, h MessageHandler, verbose bool, level zerolog.Level, zc zerolog.Context) {
+
+	fctx := ctx.RequestCtx()
+
+	fctx.SetStatusCode(fasthttp.StatusSwitchingProtocols)
+	fctx.Response.Header.Set("Upgrade", "websocket")
+	fctx.Response.Header.Set("Connection", "Upgrade")
+	fctx.Response.Header.Set("Sec-WebSocket-Accept", wsAcceptKey(fctx.Request.Header.Peek("Sec-WebSocket-Key")))
+
+	c := WSConn{opts: e.WebSocket.withDefaults(), tp: ctx.TokenPayload()}
+	user := uuid.Nil
+	if c.tp != nil {
+		user = c.tp.User()
+		at, _ := e.TokenExtractor.ExtractToken(fctx)
+		c.at = string(at)
+	}
+
+	// fctx must not be used inside of hijack handler.
+	start := fctx.Time()
+
+	fctx.Hijack(func(nc net.Conn) {
+		c.nc = nc
+		c.br = bufio.NewReader(nc)
+		c.ctx, c.cancel = context.WithCancel(e.baseCtx)
+		defer c.cancel()
+
+		e.ws.add(&c, user)
+		defer e.ws.remove(&c, user)
+
+		zl := zc.Logger()
+		zl.WithLevel(level).Msg("websocket opened")
+
+		go e.keepWebSocketAlive(&c, zc)
+
+		msgs, ce := e.serveWebSocket(&c, h, verbose, zc)
+
+		dur := time.Since(start)
+		zl.WithLevel(level).Int("code", int(ce.code)).Str("reason", ce.reason).Int("messages", msgs).Str("dur", dur.String()).Msg("websocket closed")
+
+		if e.mr != nil {
+			e.mr.ReportMetric(e.Method, e.Path, fasthttp.StatusSwitchingProtocols, dur.Seconds(), 0)
+		}
+	})
+}
+
+// serveWebSocket reads messages until the connection is closed. Returns
+// number of handled messages and close reason.
+func (e *Endpoint) serveWebSocket(c *WSConn, h MessageHandler, verbose bool, zc zerolog.Context) (int, wsCloseError) {
+
+	var ff errors.FormattingFlag
+	if verbose {
+		ff = errors.AddStack | errors.AddFields | errors.AddWrappedErrors
+	}
+
+	mt := reflect.TypeOf(h.Message()).Elem()
+	msgs := 0
+
+	for {
+		opcode, buf, err := c.readMessage()
+		if err != nil {
+			ce, ok := err.(*wsCloseError)
+			if !ok {
+				ce = &wsCloseError{WSCloseGoingAway, err.Error()}
+			}
+			// close frame is answered with the same status code or with the
+			// status code of the protocol violation.
+			c.close(ce.code, ce.reason)
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return msgs, c.closeStatus
+		}
+
+		if opcode == wsBinary {
+			c.close(WSCloseUnsupportedData, "binary messages are not supported")
+			continue
+		}
+
+		msg := reflect.New(mt).Interface()
+		if err = json.Unmarshal(buf, msg); err != nil {
+			err = errors.Catch(err).StatusCode(400).Msg("invalid message")
+		} else if err = validationError(validateStruct(msg, "json")); err == nil {
+			err = h.HandleMessage(c, msg)
+		}
+		msgs++
+
+		if err != nil {
+			zl := zc.RawJSON("err", errors.ToServerJSON(err)).Logger()
+			zl.Error().Msg("websocket message failed")
+			c.writeFrame(wsText, errors.ToJSON(err, ff))
+		}
+	}
+}
+
+// keepWebSocketAlive pings the client and checks revocation of the access
+// token until the connection is closing.
+func (e *Endpoint) keepWebSocketAlive(c *WSConn, zc zerolog.Context) {
+
+	pt := time.NewTicker(c.opts.PingInterval)
+	defer pt.Stop()
+
+	var rc <-chan time.Time
+	if e.rtc != nil && c.at != "" {
+		rt := time.NewTicker(c.opts.RevokeCheckInterval)
+		defer rt.Stop()
+		rc = rt.C
+	}
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			if e.baseCtx.Err() != nil {
+				c.close(WSCloseGoingAway, "server shutdown")
+			}
+			return
+		case <-pt.C:
+			if err := c.writeFrame(wsPing, nil); err != nil {
+				c.cancel()
+				c.nc.SetReadDeadline(time.Now())
+				return
+			}
+		case <-rc:
+			isRevoked, err := e.rtc.IsTokenRevoked(c.at)
+			if err != nil {
+				zl := zc.Logger()
+				zl.Error().Str("err", err.Error()).Msg("websocket token revocation check failed")
+				continue
+			}
+			if isRevoked {
+				c.close(WSClosePolicyViolation, "access token revoked")
+				return
+			}
+		}
+	}
+}
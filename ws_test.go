@@ -0,0 +1,221 @@
+package vatel
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+type testChatMessage struct {
+	Text string `json:"text" validate:"required"`
+}
+
+type testChatController struct{}
+
+func (c *testChatController) Handle(Context) error { return nil }
+
+func (c *testChatController) Message() interface{} { return &testChatMessage{} }
+
+func (c *testChatController) HandleMessage(conn *WSConn, msg interface{}) error {
+	return conn.Send(map[string]string{"echo": msg.(*testChatMessage).Text, "login": conn.TokenPayload().Login()})
+}
+
+type testRevoker struct{ revoked int32 }
+
+func (r *testRevoker) IsTokenRevoked(string) (bool, error) {
+	return atomic.LoadInt32(&r.revoked) == 1, nil
+}
+
+// testWSClient is the minimal WebSocket client.
+type testWSClient struct {
+	c  net.Conn
+	br *bufio.Reader
+}
+
+func (c *testWSClient) send(opcode byte, payload []byte) {
+	buf := []byte{0x80 | opcode, 0x80 | byte(len(payload)), 1, 2, 3, 4}
+	for i := range payload {
+		buf = append(buf, payload[i]^buf[2+i%4])
+	}
+	c.c.Write(buf)
+}
+
+func (c *testWSClient) read() (byte, string, error) {
+	c.c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var h [2]byte
+	if _, err := io.ReadFull(c.br, h[:]); err != nil {
+		return 0, "", err
+	}
+	n := int(h[1] & 0x7f)
+	if n == 126 {
+		var l [2]byte
+		io.ReadFull(c.br, l[:])
+		n = int(binary.BigEndian.Uint16(l[:]))
+	}
+	payload := make([]byte, n)
+	_, err := io.ReadFull(c.br, payload)
+	return h[0] & 0x0f, string(payload), err
+}
+
+func TestEndpoint_webSocket(t *testing.T) {
+
+	rtc := testRevoker{}
+	v := newTestVatel()
+	v.SetRevokeTokenChecker(&rtc)
+
+	e := Endpoint{Method: "GET", Path: "/chat", Perms: []string{"Chat"},
+		WebSocket:  WebSocketOptions{RevokeCheckInterval: 20 * time.Millisecond},
+		Controller: func() Handler { return &testChatController{} }}
+	if err := e.compile(v); err != nil {
+		t.Fatal(err)
+	}
+
+	l := zerolog.Nop()
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go (&fasthttp.Server{Handler: e.handler(&l)}).Serve(ln)
+
+	dial := func(hs string) (*testWSClient, string) {
+		c, err := ln.Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Write([]byte("GET /chat HTTP/1.1\r\nHost: x\r\nAuthorization: john\r\n" + hs + "\r\n"))
+		cl := testWSClient{c: c, br: bufio.NewReader(c)}
+		resp := ""
+		for {
+			s, err := cl.br.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == "\r\n" {
+				return &cl, resp
+			}
+			resp += s
+		}
+	}
+
+	_, resp := dial("")
+	if !strings.HasPrefix(resp, "HTTP/1.1 426") {
+		t.Errorf("426 expected, got %s", resp)
+	}
+
+	hs := "Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+	_, resp = dial(hs + "Origin: https://evil.com\r\n")
+	if !strings.HasPrefix(resp, "HTTP/1.1 403") {
+		t.Errorf("403 expected for cross-site origin, got %s", resp)
+	}
+
+	c, resp := dial(hs + "Origin: https://x\r\n")
+	if !strings.HasPrefix(resp, "HTTP/1.1 101") || !strings.Contains(strings.ToLower(resp), "sec-websocket-accept: s3pplmbitxaq9kygzzhzrbk+xoo=") {
+		t.Fatalf("unexpected handshake response: %s", resp)
+	}
+	defer c.c.Close()
+
+	c.send(wsText, []byte(`{"text":"hi"}`))
+	if op, msg, err := c.read(); err != nil || op != wsText || msg != `{"echo":"hi","login":"john"}` {
+		t.Errorf("unexpected echo: %d %s %v", op, msg, err)
+	}
+
+	c.send(wsText, []byte(`{}`))
+	if _, msg, err := c.read(); !strings.Contains(msg, "VTL-0003") {
+		t.Errorf("validation error expected, got %s %v", msg, err)
+	}
+
+	c.send(wsPing, []byte("p"))
+	if op, msg, _ := c.read(); op != wsPong || msg != "p" {
+		t.Errorf("pong expected, got %d %s", op, msg)
+	}
+
+	for i := 0; len(v.WebSocketConns(uuid.Nil)) == 0 && i < 100; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n, err := v.Broadcast(uuid.Nil, map[string]int{"n": 1}); n != 1 || err != nil {
+		t.Errorf("broadcast to 1 connection expected, got %d %v", n, err)
+	}
+	if _, msg, _ := c.read(); msg != `{"n":1}` {
+		t.Errorf("broadcasted message expected, got %s", msg)
+	}
+
+	atomic.StoreInt32(&rtc.revoked, 1)
+	op, msg, err := c.read()
+	if err != nil || op != wsClose || binary.BigEndian.Uint16([]byte(msg)) != WSClosePolicyViolation {
+		t.Errorf("close frame with status 1008 expected, got %d %q %v", op, msg, err)
+	}
+}
+
+func TestEndpoint_isWebSocketOriginAllowed(t *testing.T) {
+
+	cases := []struct {
+		opts   WebSocketOptions
+		cors   *CORSPolicy
+		origin string
+		exp    bool
+	}{
+		{origin: "", exp: true},
+		{origin: "https://api.example.com", exp: true},
+		{origin: "https://evil.com", exp: false},
+		{origin: "null", exp: false},
+		{cors: &CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}, origin: "https://app.example.com", exp: true},
+		{cors: &CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}}, origin: "https://evil.com", exp: false},
+		{opts: WebSocketOptions{AllowedOrigins: []string{"https://app.example.com"}}, cors: &CORSPolicy{AllowedOrigins: []string{"*"}},
+			origin: "https://evil.com", exp: false},
+		{opts: WebSocketOptions{AllowedOrigins: []string{"https://app.example.com"}}, origin: "https://app.example.com", exp: true},
+	}
+
+	for i, c := range cases {
+		e := Endpoint{WebSocket: c.opts, cors: c.cors}
+		var fctx fasthttp.RequestCtx
+		fctx.Request.SetRequestURI("https://api.example.com/chat")
+		if c.origin != "" {
+			fctx.Request.Header.Set("Origin", c.origin)
+		}
+		if res := e.isWebSocketOriginAllowed(&fctx); res != c.exp {
+			t.Errorf("case %d: origin %q: expected %t, got %t", i, c.origin, c.exp, res)
+		}
+	}
+}
+
+func TestWSConn_readMessage_close(t *testing.T) {
+
+	cases := []struct {
+		payload []byte
+		code    uint16
+	}{
+		{nil, WSCloseNormal},
+		{[]byte{0x03}, WSCloseProtocolError},
+		{[]byte{0x03, 0xe8, 'b', 'y', 'e'}, WSCloseNormal},
+		{[]byte{0x03, 0xe9}, WSCloseGoingAway},
+		{[]byte{0x0f, 0xa0}, 4000},
+		{[]byte{0x03, 0xe7}, WSCloseProtocolError},
+		{[]byte{0x03, 0xed}, WSCloseProtocolError},
+		{[]byte{0x03, 0xee}, WSCloseProtocolError},
+		{[]byte{0x03, 0xf7}, WSCloseProtocolError},
+		{[]byte{0x07, 0xd0}, WSCloseProtocolError},
+		{[]byte{0x13, 0x88}, WSCloseProtocolError},
+		{[]byte{0x03, 0xe8, 0xff}, WSCloseInvalidPayload},
+	}
+
+	for _, c := range cases {
+		sc, cc := net.Pipe()
+		conn := WSConn{nc: sc, br: bufio.NewReader(sc), opts: WebSocketOptions{}.withDefaults()}
+		go (&testWSClient{c: cc}).send(wsClose, c.payload)
+
+		_, _, err := conn.readMessage()
+		if ce, ok := err.(*wsCloseError); !ok || ce.code != c.code {
+			t.Errorf("payload %v: close status %d expected, got %v", c.payload, c.code, err)
+		}
+		sc.Close()
+		cc.Close()
+	}
+}